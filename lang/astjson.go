@@ -0,0 +1,426 @@
+package lang
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type astDocument struct {
+  File string `json:"file"`
+  Source string `json:"source"`
+  Root json.RawMessage `json:"root"`
+}
+
+type jsonPos struct {
+  Idx int `json:"idx"`
+  Ln int `json:"ln"`
+  Col int `json:"col"`
+}
+
+type jsonToken struct {
+  Type string `json:"type"`
+  Value any `json:"value"`
+  PosStart *jsonPos `json:"start"`
+  PosEnd *jsonPos `json:"end"`
+}
+
+type jsonNode map[string]json.RawMessage
+
+func MarshalAST(node Node) ([]byte, error) {
+  start := node.GetPosStart()
+  root, err := json.Marshal(encodeNode(node))
+  if err != nil {
+    return nil, err
+  }
+  return json.MarshalIndent(astDocument{File: start.fn, Source: start.ftxt, Root: root}, "", "  ")
+}
+
+func UnmarshalAST(data []byte) (Node, error) {
+  var doc astDocument
+  if err := json.Unmarshal(data, &doc); err != nil {
+    return nil, err
+  }
+  decoder := astDecoder{file: doc.File, source: doc.Source}
+  return decoder.node(doc.Root)
+}
+
+// ======= Encoding =======
+func encodePos(pos Position) *jsonPos {
+  if pos == (Position{}) {
+    return nil
+  }
+  return &jsonPos{Idx: pos.idx, Ln: pos.ln, Col: pos.col}
+}
+
+func encodeToken(tok Token) jsonToken {
+  return jsonToken{Type: tok.type_, Value: tok.value, PosStart: encodePos(tok.PosStart), PosEnd: encodePos(tok.PosEnd)}
+}
+
+func encodeTokens(toks []Token) []jsonToken {
+  if toks == nil {
+    return nil
+  }
+  result := []jsonToken{}
+  for _, tok := range toks {
+    result = append(result, encodeToken(tok))
+  }
+  return result
+}
+
+func encodeNodes(nodes []Node) []any {
+  if nodes == nil {
+    return nil
+  }
+  result := []any{}
+  for _, node := range nodes {
+    result = append(result, encodeNode(node))
+  }
+  return result
+}
+
+func encodeNode(node Node) any {
+  if node == nil {
+    return nil
+  }
+  result := map[string]any{
+    "start": encodePos(node.GetPosStart()),
+    "end": encodePos(node.GetPosEnd()),
+  }
+
+  switch n := node.(type) {
+    case *NumberNode:
+      result["type"] = "NumberNode"
+      result["tok"] = encodeToken(n.Tok)
+    case *StringNode:
+      result["type"] = "StringNode"
+      result["tok"] = encodeToken(n.Tok)
+    case *IfNode:
+      result["type"] = "IfNode"
+      cases := []any{}
+      for _, Case := range n.Cases {
+        cases = append(cases, encodeNodes(Case))
+      }
+      result["cases"] = cases
+      result["else"] = encodeNode(n.ElseCase)
+    case *ForNode:
+      result["type"] = "ForNode"
+      result["var"] = encodeToken(n.VarNameTok)
+      result["iterable"] = encodeNode(n.Iterable)
+      result["startVal"] = encodeNode(n.StartVal)
+      result["endVal"] = encodeNode(n.EndVal)
+      result["stepVal"] = encodeNode(n.StepVal)
+      result["body"] = encodeNode(n.BodyNode)
+    case *WhileNode:
+      result["type"] = "WhileNode"
+      result["cond"] = encodeNode(n.Cond)
+      result["body"] = encodeNode(n.BodyNode)
+    case *VarAccessNode:
+      result["type"] = "VarAccessNode"
+      result["var"] = encodeToken(n.VarName)
+    case *VarAssignNode:
+      result["type"] = "VarAssignNode"
+      result["var"] = encodeToken(n.VarName)
+      result["value"] = encodeNode(n.ValueNode)
+      result["const"] = n.IsConst
+      result["update"] = n.IsUpdate
+      result["varType"] = encodeToken(n.TypeTok)
+    case *BinOpNode:
+      result["type"] = "BinOpNode"
+      result["left"] = encodeNode(n.LeftNode)
+      result["op"] = encodeToken(n.OpTok)
+      result["right"] = encodeNode(n.RightNode)
+    case *UnaryOpNode:
+      result["type"] = "UnaryOpNode"
+      result["op"] = encodeToken(n.OpTok)
+      result["node"] = encodeNode(n.Node)
+    case *FuncDefNode:
+      result["type"] = "FuncDefNode"
+      result["name"] = encodeToken(n.VarNameTok)
+      result["args"] = encodeTokens(n.ArgNameToks)
+      result["argTypes"] = encodeTokens(n.ArgTypeToks)
+      result["returnType"] = encodeToken(n.ReturnTypeTok)
+      result["body"] = encodeNode(n.BodyNode)
+    case *CallNode:
+      result["type"] = "CallNode"
+      result["callee"] = encodeNode(n.NodeToCall)
+      result["args"] = encodeNodes(n.ArgNodes)
+    case *StatementsNode:
+      result["type"] = "StatementsNode"
+      result["statements"] = encodeNodes(n.Statements)
+    case *ReturnNode:
+      result["type"] = "ReturnNode"
+      result["value"] = encodeNode(n.NodeToReturn)
+    case *YieldNode:
+      result["type"] = "YieldNode"
+      result["value"] = encodeNode(n.Node)
+    case *SpawnNode:
+      result["type"] = "SpawnNode"
+      result["call"] = encodeNode(n.Call)
+    case *AwaitNode:
+      result["type"] = "AwaitNode"
+      result["node"] = encodeNode(n.Node)
+    case *FieldAccessNode:
+      result["type"] = "FieldAccessNode"
+      result["object"] = encodeNode(n.NodeToAccess)
+      result["field"] = encodeToken(n.FieldNameTok)
+    case *FieldAssignNode:
+      result["type"] = "FieldAssignNode"
+      result["object"] = encodeNode(n.NodeToAccess)
+      result["field"] = encodeToken(n.FieldNameTok)
+      result["value"] = encodeNode(n.ValueNode)
+    case *ClassDefNode:
+      result["type"] = "ClassDefNode"
+      result["name"] = encodeToken(n.ClassNameTok)
+      result["parent"] = encodeNode(n.ParentNode)
+      result["fields"] = encodeTokens(n.FieldNameToks)
+      result["defaults"] = encodeNodes(n.FieldValueNodes)
+      var methods []any
+      for _, method := range n.MethodNodes {
+        methods = append(methods, encodeNode(method))
+      }
+      result["methods"] = methods
+    case *SuperNode:
+      result["type"] = "SuperNode"
+      result["tok"] = encodeToken(n.Tok)
+    case *ImportNode:
+      result["type"] = "ImportNode"
+      result["path"] = encodeToken(n.PathTok)
+      result["alias"] = encodeToken(n.AliasTok)
+    case *FromImportNode:
+      result["type"] = "FromImportNode"
+      result["path"] = encodeToken(n.PathTok)
+      result["names"] = encodeTokens(n.NameToks)
+    default:
+      panic(fmt.Sprintf("No JSON encoding defined for %T", node))
+  }
+  return result
+}
+
+// ======= Decoding =======
+type astDecoder struct {
+  file string
+  source string
+}
+
+func (d *astDecoder) pos(p *jsonPos) Position {
+  if p == nil {
+    return Position{}
+  }
+  return Position{idx: p.Idx, ln: p.Ln, col: p.Col, fn: d.file, ftxt: d.source}
+}
+
+func (d *astDecoder) token(raw json.RawMessage) (Token, error) {
+  var jt struct {
+    Type string `json:"type"`
+    Value json.RawMessage `json:"value"`
+    PosStart *jsonPos `json:"start"`
+    PosEnd *jsonPos `json:"end"`
+  }
+  if err := json.Unmarshal(raw, &jt); err != nil {
+    return Token{}, err
+  }
+  tok := Token{type_: jt.Type, PosStart: d.pos(jt.PosStart), PosEnd: d.pos(jt.PosEnd)}
+
+  if len(jt.Value) == 0 || string(jt.Value) == "null" {
+    return tok, nil
+  }
+  switch jt.Type {
+    case INT:
+      value, err := strconv.Atoi(string(jt.Value))
+      if err != nil {
+        return tok, fmt.Errorf("invalid INT token value %s", jt.Value)
+      }
+      tok.value = value
+    case FLOAT:
+      value, err := strconv.ParseFloat(string(jt.Value), 64)
+      if err != nil {
+        return tok, fmt.Errorf("invalid FLOAT token value %s", jt.Value)
+      }
+      tok.value = value
+    default:
+      var value string
+      if err := json.Unmarshal(jt.Value, &value); err != nil {
+        return tok, fmt.Errorf("invalid %v token value %s", jt.Type, jt.Value)
+      }
+      tok.value = value
+  }
+  return tok, nil
+}
+
+func (d *astDecoder) tokens(raw json.RawMessage) ([]Token, error) {
+  var raws []json.RawMessage
+  if err := json.Unmarshal(raw, &raws); err != nil || raws == nil {
+    return nil, err
+  }
+  toks := []Token{}
+  for _, r := range raws {
+    tok, err := d.token(r)
+    if err != nil {
+      return nil, err
+    }
+    toks = append(toks, tok)
+  }
+  return toks, nil
+}
+
+func (d *astDecoder) nodes(raw json.RawMessage) ([]Node, error) {
+  var raws []json.RawMessage
+  if err := json.Unmarshal(raw, &raws); err != nil || raws == nil {
+    return nil, err
+  }
+  nodes := []Node{}
+  for _, r := range raws {
+    node, err := d.node(r)
+    if err != nil {
+      return nil, err
+    }
+    nodes = append(nodes, node)
+  }
+  return nodes, nil
+}
+
+func (d *astDecoder) node(raw json.RawMessage) (Node, error) {
+  if len(raw) == 0 || string(raw) == "null" {
+    return nil, nil
+  }
+  var fields jsonNode
+  if err := json.Unmarshal(raw, &fields); err != nil {
+    return nil, err
+  }
+  var type_ string
+  if err := json.Unmarshal(fields["type"], &type_); err != nil {
+    return nil, fmt.Errorf("node without type: %s", raw)
+  }
+  var start, end *jsonPos
+  if err := json.Unmarshal(fields["start"], &start); err != nil {
+    return nil, err
+  }
+  if err := json.Unmarshal(fields["end"], &end); err != nil {
+    return nil, err
+  }
+  posStart, posEnd := d.pos(start), d.pos(end)
+
+  // the first error wins, later calls become no-ops
+  var err error
+  node := func(key string) Node {
+    if err != nil { return nil }
+    var n Node
+    n, err = d.node(fields[key])
+    return n
+  }
+  nodes := func(key string) []Node {
+    if err != nil { return nil }
+    var n []Node
+    n, err = d.nodes(fields[key])
+    return n
+  }
+  token := func(key string) Token {
+    if err != nil { return Token{} }
+    var t Token
+    t, err = d.token(fields[key])
+    return t
+  }
+  tokens := func(key string) []Token {
+    if err != nil { return nil }
+    var t []Token
+    t, err = d.tokens(fields[key])
+    return t
+  }
+
+  var result Node
+  switch type_ {
+    case "NumberNode":
+      result = &NumberNode{Tok: token("tok"), PosStart: posStart, PosEnd: posEnd}
+    case "StringNode":
+      result = &StringNode{Tok: token("tok"), PosStart: posStart, PosEnd: posEnd}
+    case "IfNode":
+      var rawCases []json.RawMessage
+      if err = json.Unmarshal(fields["cases"], &rawCases); err != nil {
+        return nil, err
+      }
+      cases := [][]Node{}
+      for _, rawCase := range rawCases {
+        var Case []Node
+        if Case, err = d.nodes(rawCase); err != nil {
+          return nil, err
+        }
+        cases = append(cases, Case)
+      }
+      result = &IfNode{Cases: cases, ElseCase: node("else"), PosStart: posStart, PosEnd: posEnd}
+    case "ForNode":
+      result = &ForNode{
+        VarNameTok: token("var"), Iterable: node("iterable"), StartVal: node("startVal"), EndVal: node("endVal"),
+        StepVal: node("stepVal"), BodyNode: node("body"), PosStart: posStart, PosEnd: posEnd,
+      }
+    case "WhileNode":
+      result = &WhileNode{Cond: node("cond"), BodyNode: node("body"), PosStart: posStart, PosEnd: posEnd}
+    case "VarAccessNode":
+      result = &VarAccessNode{VarName: token("var"), PosStart: posStart, PosEnd: posEnd}
+    case "VarAssignNode":
+      var isConst, isUpdate bool
+      if raw, ok := fields["const"]; ok {
+        err = json.Unmarshal(raw, &isConst)
+      }
+      if raw, ok := fields["update"]; ok && err == nil {
+        err = json.Unmarshal(raw, &isUpdate)
+      }
+      result = &VarAssignNode{VarName: token("var"), ValueNode: node("value"), IsConst: isConst, IsUpdate: isUpdate, TypeTok: token("varType"), PosStart: posStart, PosEnd: posEnd}
+    case "BinOpNode":
+      result = &BinOpNode{LeftNode: node("left"), OpTok: token("op"), RightNode: node("right"), PosStart: posStart, PosEnd: posEnd}
+    case "UnaryOpNode":
+      result = &UnaryOpNode{OpTok: token("op"), Node: node("node"), PosStart: posStart, PosEnd: posEnd}
+    case "FuncDefNode":
+      result = &FuncDefNode{
+        VarNameTok: token("name"), ArgNameToks: tokens("args"), ArgTypeToks: tokens("argTypes"),
+        ReturnTypeTok: token("returnType"), BodyNode: node("body"), PosStart: posStart, PosEnd: posEnd,
+      }
+    case "CallNode":
+      result = &CallNode{NodeToCall: node("callee"), ArgNodes: nodes("args"), PosStart: posStart, PosEnd: posEnd}
+    case "StatementsNode":
+      result = &StatementsNode{Statements: nodes("statements"), PosStart: posStart, PosEnd: posEnd}
+    case "ReturnNode":
+      result = &ReturnNode{NodeToReturn: node("value"), PosStart: posStart, PosEnd: posEnd}
+    case "YieldNode":
+      result = &YieldNode{Node: node("value"), PosStart: posStart, PosEnd: posEnd}
+    case "SpawnNode":
+      callNode := node("call")
+      call, ok := callNode.(*CallNode)
+      if !ok {
+        return nil, fmt.Errorf("spawned call must be a CallNode, got %T", callNode)
+      }
+      result = &SpawnNode{Call: call, PosStart: posStart, PosEnd: posEnd}
+    case "AwaitNode":
+      result = &AwaitNode{Node: node("node"), PosStart: posStart, PosEnd: posEnd}
+    case "FieldAccessNode":
+      result = &FieldAccessNode{NodeToAccess: node("object"), FieldNameTok: token("field"), PosStart: posStart, PosEnd: posEnd}
+    case "FieldAssignNode":
+      result = &FieldAssignNode{NodeToAccess: node("object"), FieldNameTok: token("field"), ValueNode: node("value"), PosStart: posStart, PosEnd: posEnd}
+    case "ClassDefNode":
+      var methods []*FuncDefNode
+      for _, method := range nodes("methods") {
+        fdn, ok := method.(*FuncDefNode)
+        if !ok {
+          return nil, fmt.Errorf("class method must be a FuncDefNode, got %T", method)
+        }
+        methods = append(methods, fdn)
+      }
+      result = &ClassDefNode{
+        ClassNameTok: token("name"), ParentNode: node("parent"),
+        FieldNameToks: tokens("fields"), FieldValueNodes: nodes("defaults"), MethodNodes: methods,
+        PosStart: posStart, PosEnd: posEnd,
+      }
+    case "SuperNode":
+      result = &SuperNode{Tok: token("tok"), PosStart: posStart, PosEnd: posEnd}
+    case "ImportNode":
+      result = &ImportNode{PathTok: token("path"), AliasTok: token("alias"), PosStart: posStart, PosEnd: posEnd}
+    case "FromImportNode":
+      result = &FromImportNode{PathTok: token("path"), NameToks: tokens("names"), PosStart: posStart, PosEnd: posEnd}
+    default:
+      return nil, fmt.Errorf("unknown node type '%v'", type_)
+  }
+  if err != nil {
+    return nil, err
+  }
+  return result, nil
+}
@@ -0,0 +1,83 @@
+package lang
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestASTJSONRoundTrip encodes the programs in testdata and a few with the
+// syntax they lack, decodes them again and encodes the result, which must
+// give the same document and tree.
+func TestASTJSONRoundTrip(t *testing.T) {
+  paths, _ := filepath.Glob(filepath.Join("testdata", "*.scv"))
+  if len(paths) == 0 {
+    t.Fatal("no programs in testdata")
+  }
+  sources := map[string]string{
+    "<annotations>": "fn f(a: int, b) -> str { const c: str = \"x\"; c }\nvar n: num = 1.5",
+    "<assignments>": "var n = 1\nn = n + 1\nfn inc() { n = n + 1 }",
+    "<imports>": "import \"lib/m.scv\" as m\nfrom \"n.scv\" import a, b",
+    "<classes>": "class A(B) { x; y = 2\n  fn get(self) { super.get(self) + self.x } }",
+  }
+  for _, path := range paths {
+    text, err := os.ReadFile(path)
+    if err != nil {
+      t.Fatal(err)
+    }
+    sources[path] = string(text)
+  }
+
+  for name, text := range sources {
+    node, err := Parse(name, text)
+    if err != nil {
+      t.Fatalf("%v: %v", name, err.AsString())
+    }
+    encoded, encodeErr := MarshalAST(node)
+    if encodeErr != nil {
+      t.Fatalf("%v: %v", name, encodeErr)
+    }
+    decoded, decodeErr := UnmarshalAST(encoded)
+    if decodeErr != nil {
+      t.Fatalf("%v: %v", name, decodeErr)
+    }
+    if got, want := decoded.String(), node.String(); got != want {
+      t.Errorf("%v: decoded to\n%v\nnot\n%v", name, got, want)
+    }
+    again, encodeErr := MarshalAST(decoded)
+    if encodeErr != nil {
+      t.Fatalf("%v: %v", name, encodeErr)
+    }
+    if string(again) != string(encoded) {
+      t.Errorf("%v: encoding the decoded tree gave a different document", name)
+    }
+    if start := decoded.GetPosStart(); start.fn != name || start.ftxt != text {
+      t.Errorf("%v: positions of the decoded tree are in %v", name, start.fn)
+    }
+  }
+}
+
+func TestASTJSONMalformed(t *testing.T) {
+  tests := []struct {
+    json string
+    want string
+  }{
+    {`{"file": "x", "root": `, "unexpected end of JSON input"},
+    {`[]`, "cannot unmarshal array"},
+    {`{"root": {"start": null, "end": null}}`, "node without type"},
+    {`{"root": {"type": "NoSuchNode", "start": null, "end": null}}`, "NoSuchNode"},
+    {`{"root": {"type": "NumberNode", "start": null, "end": null, "tok": {"type": "INT", "value": "one"}}}`, "invalid INT token value"},
+    {`{"root": {"type": "StatementsNode", "start": null, "end": null, "statements": [{"type": 3}]}}`, "node without type"},
+    {`{"root": {"type": "StatementsNode", "start": null, "end": null, "statements": {}}}`, "cannot unmarshal object"},
+    {`{"root": {"type": "NumberNode", "start": {"idx": "0"}, "end": null}}`, "cannot unmarshal string"},
+  }
+  for _, test := range tests {
+    node, err := UnmarshalAST([]byte(test.json))
+    if err == nil {
+      t.Errorf("%v: decoded %v", test.json, node)
+    } else if !strings.Contains(err.Error(), test.want) {
+      t.Errorf("%v: got %v, want %v", test.json, err, test.want)
+    }
+  }
+}
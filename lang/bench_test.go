@@ -0,0 +1,167 @@
+package lang
+
+import (
+	"testing"
+)
+
+// benchPrograms are the programs the benchmarks run, see them with
+// go test -bench . -benchmem.
+var benchPrograms = []struct {
+  name string
+  text string
+}{
+  {"fib", `fn fib(n) { if n < 2 { n } else { fib(n - 1) + fib(n - 2) } }
+fib(18)`},
+  {"loop", `fn sum(n) {
+  var total = 0
+  for i = 1 in n { var total = total + i * 2 - 1 }
+  total
+}
+sum(20000)`},
+  {"while", `fn count(n) {
+  var i = 0
+  while i < n { var i = i + 1 }
+  i
+}
+count(20000)`},
+  {"closures", `fn adder(n) { fn add(x) { x + n } }
+fn run(n) {
+  var total = 0
+  for i = 1 in n {
+    var add = adder(i)
+    var total = add(total)
+  }
+  total
+}
+run(5000)`},
+  {"methods", `class Counter {
+  n = 0
+  fn inc(self) { self.n = self.n + 1 }
+}
+fn run(n) {
+  var c = Counter()
+  for i = 1 in n { c.inc() }
+  c.n
+}
+run(5000)`},
+  {"strings", `fn run(n) {
+  var s = ""
+  for i = 1 in n { var s = s + "x" }
+  len(s)
+}
+run(2000)`},
+}
+
+func benchNode(b *testing.B, text string) Node {
+  node, err := Parse("<bench>", text)
+  if err != nil {
+    b.Fatal(err.AsString())
+  }
+  return Optimize(node)
+}
+
+// BenchmarkRun runs the programs with the interpreter and the VM.
+func BenchmarkRun(b *testing.B) {
+  for _, program := range benchPrograms {
+    for _, backend := range []struct {
+      name string
+      options Options
+    }{{"interpreter", Options{}}, {"vm", Options{VM: true}}} {
+      b.Run(program.name+"/"+backend.name, func(b *testing.B) {
+        node := benchNode(b, program.text)
+        for b.Loop() {
+          context := Context{DisplayName: "<program>", SymbolTable: NewGlobals()}
+          if _, err := interpret(node, context, backend.options); err != nil {
+            b.Fatal(err.AsString())
+          }
+        }
+      })
+    }
+  }
+}
+
+// unresolve undoes Resolve: without layouts every frame is a map again and
+// every variable is looked up by name through the chain of parent tables,
+// the way they were found before variables had slots.
+func unresolve(node Node) {
+  Inspect(node, func(node Node) bool {
+    switch n := node.(type) {
+      case *VarAccessNode:
+        n.Binding = Binding{}
+      case *VarAssignNode:
+        n.Binding = Binding{}
+      case *ForNode:
+        n.Binding = Binding{}
+        n.Layout = nil
+      case *FuncDefNode:
+        n.Layout = nil
+    }
+    return true
+  })
+}
+
+// BenchmarkVariables compares variables resolved to slots with the map
+// frames and lookups by name they replaced, on the tree walker.
+func BenchmarkVariables(b *testing.B) {
+  for _, program := range benchPrograms {
+    for _, resolved := range []bool{true, false} {
+      name := program.name + "/slots"
+      if !resolved {
+        name = program.name + "/names"
+      }
+      b.Run(name, func(b *testing.B) {
+        node := benchNode(b, program.text)
+        Resolve(node)
+        if !resolved {
+          unresolve(node)
+        }
+        for b.Loop() {
+          context := Context{DisplayName: "<program>", SymbolTable: NewGlobals()}
+          interpreter := Interpreter{}
+          if res := interpreter.Visit(node, context); res.error != nil {
+            b.Fatal(res.error.AsString())
+          }
+        }
+      })
+    }
+  }
+}
+
+// BenchmarkRegistered runs a script that calls a Go function in a loop, which
+// converts the arguments and the result on every call.
+func BenchmarkRegistered(b *testing.B) {
+  for _, vm := range []bool{false, true} {
+    name := "interpreter"
+    if vm {
+      name = "vm"
+    }
+    b.Run(name, func(b *testing.B) {
+      engine := NewEngine()
+      engine.Options.VM = vm
+      if err := engine.Register("scale", func(x int, by float64) float64 { return float64(x) * by }); err != nil {
+        b.Fatal(err)
+      }
+      if _, err := engine.Run("<bench>", "fn run(n) { var total = 0; for i = 1 in n { var total = total + scale(i, 0.5) }; total }"); err != nil {
+        b.Fatal(err)
+      }
+      for b.Loop() {
+        if _, err := engine.Run("<bench>", "run(5000)"); err != nil {
+          b.Fatal(err)
+        }
+      }
+    })
+  }
+}
+
+// BenchmarkEngineCall calls a script function from Go.
+func BenchmarkEngineCall(b *testing.B) {
+  engine := NewEngine()
+  if _, err := engine.Run("<bench>", "fn add(a, b) { a + b }"); err != nil {
+    b.Fatal(err)
+  }
+  for b.Loop() {
+    if _, err := engine.Call("add", 1, 2); err != nil {
+      b.Fatal(err)
+    }
+  }
+}
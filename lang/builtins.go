@@ -0,0 +1,153 @@
+package lang
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func null(context Context) Val {
+  return NewNumber(0).SetContext(&context)
+}
+
+func boolean(value bool, context Context) Val {
+  return NewNumber(BoolToInt(value)).SetContext(&context)
+}
+
+// text is what print and str make of a value, strings without their quotes.
+func text(value Val) string {
+  if s, ok := value.(*StringVal); ok {
+    return s.value
+  }
+  return value.String()
+}
+
+// typeName is what type returns, the names the type annotations use where
+// there is one.
+func typeName(value Val) string {
+  switch v := value.(type) {
+    case *Number:
+      if _, ok := v.value.(float64); ok {
+        return TypeFloat
+      }
+      return TypeInt
+    case *StringVal:
+      return TypeStr
+    case *Function, *BuiltinFunction, *BoundMethod:
+      return TypeFn
+    case *Class:
+      return "class"
+    case *Instance:
+      return v.Class.Name
+    case *GoObject:
+      return v.info.name
+    case *Module:
+      return "module"
+    case *Task:
+      return "task"
+    case *Channel:
+      return "channel"
+    case *GeneratorVal:
+      return "generator"
+    case *ListVal:
+      return "list"
+    case *MapVal:
+      return "map"
+  }
+  return TypeAny
+}
+
+func builtinPrint(b *BuiltinFunction, args []Val, context Context) RTResult {
+  fmt.Fprintln(context.run.stdout(), text(args[0]))
+  return builtinResult(null(context), nil)
+}
+
+func builtinInput(b *BuiltinFunction, args []Val, context Context) RTResult {
+  fmt.Fprint(context.run.stdout(), text(args[0]))
+  line, _ := context.run.reader().ReadString('\n')
+  line = strings.TrimRight(line, "\r\n")
+  return builtinResult(NewString(line).SetContext(&context), nil)
+}
+
+func builtinLen(b *BuiltinFunction, args []Val, context Context) RTResult {
+  var length int
+  switch v := args[0].(type) {
+    case *StringVal:
+      length = utf8.RuneCountInString(v.value)
+    case *ListVal:
+      length = v.Len()
+    case *MapVal:
+      length = v.Len()
+    default:
+      return builtinResult(nil, b.Error(fmt.Sprintf("%v has no length", describe(args[0])), context))
+  }
+  return builtinResult(NewNumber(length).SetContext(&context), nil)
+}
+
+func builtinType(b *BuiltinFunction, args []Val, context Context) RTResult {
+  return builtinResult(NewString(typeName(args[0])).SetContext(&context), nil)
+}
+
+func builtinStr(b *BuiltinFunction, args []Val, context Context) RTResult {
+  return builtinResult(NewString(text(args[0])).SetContext(&context), nil)
+}
+
+func builtinInt(b *BuiltinFunction, args []Val, context Context) RTResult {
+  switch v := args[0].(type) {
+    case *Number:
+      if f, ok := v.value.(float64); ok {
+        return builtinResult(NewNumber(int(f)).SetContext(&context), nil)
+      }
+      return builtinResult(NewNumber(v.value).SetContext(&context), nil)
+    case *StringVal:
+      if n, err := strconv.Atoi(strings.TrimSpace(v.value)); err == nil {
+        return builtinResult(NewNumber(n).SetContext(&context), nil)
+      }
+  }
+  return builtinResult(nil, b.Error(fmt.Sprintf("Cannot convert %v to int", describe(args[0])), context))
+}
+
+func builtinFloat(b *BuiltinFunction, args []Val, context Context) RTResult {
+  switch v := args[0].(type) {
+    case *Number:
+      if n, ok := v.value.(int); ok {
+        return builtinResult(NewNumber(float64(n)).SetContext(&context), nil)
+      }
+      return builtinResult(NewNumber(v.value).SetContext(&context), nil)
+    case *StringVal:
+      if f, err := strconv.ParseFloat(strings.TrimSpace(v.value), 64); err == nil {
+        return builtinResult(NewNumber(f).SetContext(&context), nil)
+      }
+  }
+  return builtinResult(nil, b.Error(fmt.Sprintf("Cannot convert %v to float", describe(args[0])), context))
+}
+
+func builtinIsNumber(b *BuiltinFunction, args []Val, context Context) RTResult {
+  _, ok := args[0].(*Number)
+  return builtinResult(boolean(ok, context), nil)
+}
+
+func builtinIsString(b *BuiltinFunction, args []Val, context Context) RTResult {
+  _, ok := args[0].(*StringVal)
+  return builtinResult(boolean(ok, context), nil)
+}
+
+func builtinIsFunction(b *BuiltinFunction, args []Val, context Context) RTResult {
+  return builtinResult(boolean(typeName(args[0]) == TypeFn, context), nil)
+}
+
+func builtinClear(b *BuiltinFunction, args []Val, context Context) RTResult {
+  fmt.Fprint(context.run.stdout(), "\033[H\033[2J")
+  return builtinResult(null(context), nil)
+}
+
+// builtinExit stops the run with an error for which Exited reports true,
+// leaving it to the host to end the process.
+func builtinExit(b *BuiltinFunction, args []Val, context Context) RTResult {
+  return builtinResult(nil, ExitError(*b.PosStart, *b.PosEnd, context))
+}
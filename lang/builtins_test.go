@@ -0,0 +1,52 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPrintAndInput(t *testing.T) {
+  text := "var name = input(\"name? \")\nprint(\"hello \" + name)\nvar again = input(\"\")\nprint(again)"
+  for _, vm := range []bool{false, true} {
+    var out bytes.Buffer
+    options := Options{VM: vm, Stdout: &out, Stdin: strings.NewReader("ada\nagain\n")}
+    if _, err := RunWithOptions("<test>", text, NewGlobals(), options); err != nil {
+      t.Fatal(err)
+    }
+    if want := "name? hello ada\nagain\n"; out.String() != want {
+      t.Errorf("vm %v: printed %q, want %q", vm, out.String(), want)
+    }
+  }
+
+  var out bytes.Buffer
+  engine := NewEngine()
+  engine.Options.Stdout = &out
+  if _, err := engine.Run("<test>", "print(\"from the engine\")"); err != nil {
+    t.Fatal(err)
+  }
+  if out.String() != "from the engine\n" {
+    t.Errorf("engine printed %q", out.String())
+  }
+}
+
+func TestExit(t *testing.T) {
+  text := "print(\"before\")\nfn stop() { exit() }\nstop()\nprint(\"after\")"
+  for _, vm := range []bool{false, true} {
+    var out bytes.Buffer
+    _, err := RunWithOptions("<test>", text, NewGlobals(), Options{VM: vm, Stdout: &out})
+    if err == nil || !err.Exited() || err.Interrupted() {
+      t.Errorf("vm %v: got %v, want an exit", vm, err)
+    }
+    if out.String() != "before\n" {
+      t.Errorf("vm %v: printed %q", vm, out.String())
+    }
+  }
+
+  _, err := NewEngine().Run("<test>", "exit()")
+  var exitErr *Error
+  if !errors.As(err, &exitErr) || !exitErr.Exited() {
+    t.Errorf("engine: got %v, want an exit", err)
+  }
+}
@@ -0,0 +1,284 @@
+package lang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Opcode byte
+
+const (
+  OpConst Opcode = iota // push Constants[Arg] as a Number or StringVal
+  OpNil                 // push nothing, the value of statements
+  OpNull                // push null, the value of an empty block or a bare return
+  OpPop
+  OpGetVar
+  OpSetVar              // declare or update the name and push nil, like VarAssignNode
+  OpBinary
+  OpUnary
+  OpJump                // jump to Arg
+  OpJumpIfFalse         // pop the condition, jump to Arg unless it is true
+  OpForPrep             // pop step (when Arg is 1), end and start, or the iterable (when Arg is 2), push the loop state
+  OpForIter             // assign the next value or pop the state and jump to Arg
+  OpFunction
+  OpCallable            // check that the top of the stack can be called
+  OpCall                // call with Arg arguments
+  OpGetField
+  OpSetField
+  OpReturn
+  OpEval                // hand Node to the tree-walking interpreter
+  OpLoop                // count an iteration of a while loop against the budget
+  OpSpawn               // start a task calling with Arg arguments
+  OpAwait
+  OpYield
+)
+
+var opcodeNames = [...]string{
+  "CONST", "NIL", "NULL", "POP", "GET_VAR", "SET_VAR", "BINARY", "UNARY", "JUMP", "JUMP_IF_FALSE",
+  "FOR_PREP", "FOR_ITER", "FUNCTION", "CALLABLE", "CALL", "GET_FIELD", "SET_FIELD", "RETURN", "EVAL",
+  "LOOP", "SPAWN", "AWAIT", "YIELD",
+}
+
+func (op Opcode) String() string {
+  return opcodeNames[op]
+}
+
+// Every instruction keeps the node it was compiled from, the VM takes
+// positions and names from it so values and errors match the interpreter.
+type Instruction struct {
+  Op Opcode
+  Arg int
+  Node Node
+}
+
+type Chunk struct {
+  Name string
+  Code []Instruction
+  Constants []any
+  Program *Program
+}
+
+// Disassemble lists the instructions of the chunk, one per line.
+func (c *Chunk) Disassemble() string {
+  var sb strings.Builder
+  fmt.Fprintf(&sb, "== %v ==\n", c.Name)
+  for idx, ins := range c.Code {
+    fmt.Fprintf(&sb, "%04d %-14v", idx, ins.Op)
+    switch ins.Op {
+      case OpConst:
+        fmt.Fprintf(&sb, "%v (%#v)", ins.Arg, c.Constants[ins.Arg])
+      case OpJump, OpJumpIfFalse, OpForPrep, OpForIter, OpCall, OpSpawn:
+        fmt.Fprintf(&sb, "%v", ins.Arg)
+      case OpGetVar:
+        fmt.Fprintf(&sb, "%v", ins.Node.(*VarAccessNode).VarName.value)
+      case OpSetVar:
+        fmt.Fprintf(&sb, "%v", ins.Node.(*VarAssignNode).VarName.value)
+      case OpGetField:
+        fmt.Fprintf(&sb, "%v", ins.Node.(*FieldAccessNode).FieldNameTok.value)
+      case OpSetField:
+        fmt.Fprintf(&sb, "%v", ins.Node.(*FieldAssignNode).FieldNameTok.value)
+      case OpBinary:
+        fmt.Fprintf(&sb, "%v", ins.Node.(*BinOpNode).OpTok.Symbol())
+      case OpUnary:
+        fmt.Fprintf(&sb, "%v", ins.Node.(*UnaryOpNode).OpTok.Symbol())
+      case OpEval:
+        fmt.Fprintf(&sb, "%T", ins.Node)
+    }
+    sb.WriteString("\n")
+  }
+  return sb.String()
+}
+
+// Program is the compiled form of a tree: the top-level chunk and one chunk
+// per function body, including class methods.
+type Program struct {
+  Main *Chunk
+  Functions map[*FuncDefNode]*Chunk
+}
+
+func (p *Program) Disassemble() string {
+  var sb strings.Builder
+  sb.WriteString(p.Main.Disassemble())
+
+  nodes := []*FuncDefNode{}
+  for node := range p.Functions {
+    nodes = append(nodes, node)
+  }
+  sort.Slice(nodes, func(a, b int) bool { return nodes[a].PosStart.idx < nodes[b].PosStart.idx })
+  for _, node := range nodes {
+    sb.WriteString("\n" + p.Functions[node].Disassemble())
+  }
+  return sb.String()
+}
+
+// Compile turns a resolved tree into bytecode. Class definitions, super and
+// imports are rare enough that the VM hands them to the interpreter.
+func Compile(node Node) *Program {
+  program := &Program{Functions: make(map[*FuncDefNode]*Chunk)}
+  program.Main = program.compileChunk("<program>", node)
+  return program
+}
+
+func (p *Program) compileChunk(name string, body Node) *Chunk {
+  c := &compiler{chunk: &Chunk{Name: name, Program: p}, program: p}
+  c.compile(body)
+  return c.chunk
+}
+
+type compiler struct {
+  chunk *Chunk
+  program *Program
+}
+
+func (c *compiler) emit(op Opcode, arg int, node Node) int {
+  c.chunk.Code = append(c.chunk.Code, Instruction{op, arg, node})
+  return len(c.chunk.Code) - 1
+}
+
+func (c *compiler) patch(at int) {
+  c.chunk.Code[at].Arg = len(c.chunk.Code)
+}
+
+func (c *compiler) constant(value any) int {
+  for idx, constant := range c.chunk.Constants {
+    if constant == value {
+      return idx
+    }
+  }
+  c.chunk.Constants = append(c.chunk.Constants, value)
+  return len(c.chunk.Constants) - 1
+}
+
+func (c *compiler) function(node *FuncDefNode) {
+  name := "<anonymous>"
+  if tokName, _ := node.VarNameTok.value.(string); tokName != "" {
+    name = tokName
+  }
+  c.program.Functions[node] = c.program.compileChunk(name, node.BodyNode)
+}
+
+func (c *compiler) compile(node Node) {
+  switch n := node.(type) {
+    case *NumberNode:
+      c.emit(OpConst, c.constant(n.Tok.value), n)
+    case *StringNode:
+      c.emit(OpConst, c.constant(n.Tok.value), n)
+    case *VarAccessNode:
+      c.emit(OpGetVar, 0, n)
+    case *VarAssignNode:
+      c.compile(n.ValueNode)
+      c.emit(OpSetVar, 0, n)
+    case *BinOpNode:
+      c.compile(n.LeftNode)
+      c.compile(n.RightNode)
+      c.emit(OpBinary, 0, n)
+    case *UnaryOpNode:
+      c.compile(n.Node)
+      c.emit(OpUnary, 0, n)
+    case *IfNode:
+      exits := []int{}
+      for _, Case := range n.Cases {
+        c.compile(Case[0])
+        next := c.emit(OpJumpIfFalse, 0, n)
+        c.compile(Case[1])
+        exits = append(exits, c.emit(OpJump, 0, n))
+        c.patch(next)
+      }
+      if n.ElseCase != nil {
+        c.compile(n.ElseCase)
+      } else {
+        c.emit(OpNil, 0, n)
+      }
+      for _, exit := range exits {
+        c.patch(exit)
+      }
+    case *ForNode:
+      if n.Iterable != nil {
+        c.compile(n.Iterable)
+        c.emit(OpForPrep, 2, n)
+      } else {
+        c.compile(n.StartVal)
+        c.compile(n.EndVal)
+        hasStep := 0
+        if n.StepVal != nil {
+          c.compile(n.StepVal)
+          hasStep = 1
+        }
+        c.emit(OpForPrep, hasStep, n)
+      }
+      loop := c.emit(OpForIter, 0, n)
+      c.compile(n.BodyNode)
+      c.emit(OpPop, 0, n)
+      c.emit(OpJump, loop, n)
+      c.patch(loop)
+    case *WhileNode:
+      loop := len(c.chunk.Code)
+      c.compile(n.Cond)
+      exit := c.emit(OpJumpIfFalse, 0, n)
+      c.emit(OpLoop, 0, n)
+      c.compile(n.BodyNode)
+      c.emit(OpPop, 0, n)
+      c.emit(OpJump, loop, n)
+      c.patch(exit)
+      c.emit(OpNil, 0, n)
+    case *FuncDefNode:
+      c.function(n)
+      c.emit(OpFunction, 0, n)
+    case *CallNode:
+      c.compile(n.NodeToCall)
+      c.emit(OpCallable, 0, n)
+      for _, arg := range n.ArgNodes {
+        c.compile(arg)
+      }
+      c.emit(OpCall, len(n.ArgNodes), n)
+    case *SpawnNode:
+      c.compile(n.Call.NodeToCall)
+      c.emit(OpCallable, 0, n.Call)
+      for _, arg := range n.Call.ArgNodes {
+        c.compile(arg)
+      }
+      c.emit(OpSpawn, len(n.Call.ArgNodes), n)
+    case *AwaitNode:
+      c.compile(n.Node)
+      c.emit(OpAwait, 0, n)
+    case *YieldNode:
+      c.compile(n.Node)
+      c.emit(OpYield, 0, n)
+    case *StatementsNode:
+      if len(n.Statements) == 0 {
+        c.emit(OpNull, 0, n)
+      }
+      for idx, statement := range n.Statements {
+        c.compile(statement)
+        if idx < len(n.Statements)-1 {
+          c.emit(OpPop, 0, n)
+        }
+      }
+    case *ReturnNode:
+      if n.NodeToReturn != nil {
+        c.compile(n.NodeToReturn)
+      } else {
+        c.emit(OpNull, 0, n)
+      }
+      c.emit(OpReturn, 0, n)
+    case *FieldAccessNode:
+      c.compile(n.NodeToAccess)
+      c.emit(OpGetField, 0, n)
+    case *FieldAssignNode:
+      c.compile(n.NodeToAccess)
+      c.compile(n.ValueNode)
+      c.emit(OpSetField, 0, n)
+    default:
+      // The interpreter creates the methods of a class through makeFunction,
+      // which picks up their chunks from the program.
+      Inspect(node, func(child Node) bool {
+        if fdn, ok := child.(*FuncDefNode); ok {
+          c.function(fdn)
+          return false
+        }
+        return true
+      })
+      c.emit(OpEval, 0, node)
+  }
+}
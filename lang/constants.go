@@ -40,12 +40,16 @@ const (
   ARROW         = "ARROW"
 
   COMMA         = "COMMA"
+  COLON         = "COLON"
+  DOT           = "DOT"
+  NEWLINE       = "NEWLINE"
 
   EOF           = "EOF"
 )
 
 var KEYWORDS = []string{
   "var",
+  "const",
 
   "and",
   "or",
@@ -60,4 +64,17 @@ var KEYWORDS = []string{
   "while",
   "for",
   "in",
+
+  "return",
+
+  "spawn",
+  "await",
+  "yield",
+
+  "class",
+  "super",
+
+  "import",
+  "from",
+  "as",
 }
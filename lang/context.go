@@ -5,4 +5,29 @@ type Context struct {
   Parent *Context
   ParentEntryPos *Position
   SymbolTable *SymbolTable
+  // Frames replaced by tail calls between Parent and this context.
+  Elided int
+  // Number of function calls that lead to this context.
+  Depth int
+  // Shared by every context of a run, nil outside of one.
+  run *runState
+  // The generator whose body runs in the context, if any.
+  coroutine *coroutine
+}
+
+// maxDepth is how deep calls made from the context may nest.
+func (c *Context) maxDepth() int {
+  if c.run != nil && c.run.options.MaxDepth > 0 {
+    return c.run.options.MaxDepth
+  }
+  return DefaultMaxDepth
+}
+
+// maxTailCalls is how many frames tail calls from the context may replace in
+// a row.
+func (c *Context) maxTailCalls() int {
+  if c.run != nil && c.run.options.MaxTailCalls > 0 {
+    return c.run.options.MaxTailCalls
+  }
+  return DefaultMaxTailCalls
 }
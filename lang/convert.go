@@ -0,0 +1,286 @@
+package lang
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ToVal converts a Go value to a Val: bools and numbers become numbers,
+// slices and arrays lists, maps with string keys maps, funcs built-in
+// functions and pointers to structs GoObjects, structs are copied to one.
+// Vals are returned as they are and nil becomes null.
+func ToVal(value any) (Val, error) {
+  return toVal("func", value, nil, false)
+}
+
+// toVal names the functions it converts name. When restricted, the objects
+// it makes of structs, and those of what its functions return, only show
+// what allow lists, like those a restricted GoObject gives for its fields.
+func toVal(name string, value any, allow []string, restricted bool) (Val, error) {
+  if value == nil {
+    return NewNumber(0), nil
+  }
+  if v, ok := value.(Val); ok {
+    return v, nil
+  }
+
+  rv := reflect.ValueOf(value)
+  switch rv.Kind() {
+    case reflect.Bool:
+      return NewNumber(BoolToInt(rv.Bool())), nil
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+      return NewNumber(int(rv.Int())), nil
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+      n := rv.Uint()
+      if n > uint64(^uint(0)>>1) {
+        return nil, fmt.Errorf("%v overflows int", n)
+      }
+      return NewNumber(int(n)), nil
+    case reflect.Float32, reflect.Float64:
+      return NewNumber(rv.Float()), nil
+    case reflect.String:
+      return NewString(rv.String()), nil
+    case reflect.Slice, reflect.Array:
+      if rv.Kind() == reflect.Slice && rv.IsNil() {
+        return NewNumber(0), nil
+      }
+      elements := make([]Val, rv.Len())
+      for idx := range rv.Len() {
+        element, err := toVal(name, rv.Index(idx).Interface(), allow, restricted)
+        if err != nil {
+          return nil, fmt.Errorf("element %v: %w", idx, err)
+        }
+        elements[idx] = element
+      }
+      return NewList(elements), nil
+    case reflect.Map:
+      if rv.Type().Key().Kind() != reflect.String {
+        return nil, fmt.Errorf("cannot convert %v, map keys must be strings", rv.Type())
+      }
+      if rv.IsNil() {
+        return NewNumber(0), nil
+      }
+      entries := make(map[string]Val, rv.Len())
+      iter := rv.MapRange()
+      for iter.Next() {
+        key := iter.Key().String()
+        entry, err := toVal(name, iter.Value().Interface(), allow, restricted)
+        if err != nil {
+          return nil, fmt.Errorf("key %q: %w", key, err)
+        }
+        entries[key] = entry
+      }
+      return NewMap(entries), nil
+    case reflect.Func:
+      if rv.IsNil() {
+        return NewNumber(0), nil
+      }
+      return wrapFunc(name, rv, allow, restricted)
+    case reflect.Struct:
+      ptr := reflect.New(rv.Type())
+      ptr.Elem().Set(rv)
+      return wrapObject(ptr, allow, restricted)
+    case reflect.Pointer, reflect.Interface:
+      if rv.IsNil() {
+        return NewNumber(0), nil
+      }
+      if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Struct {
+        return wrapObject(rv, allow, restricted)
+      }
+  }
+  return nil, fmt.Errorf("cannot convert %v", rv.Type())
+}
+
+// FromVal converts a Val to the Go value it naturally is: an int, float64,
+// string, []any, map[string]any or the pointer a GoObject wraps. Null becomes 0, like in scripts, and
+// values without a Go counterpart are returned as they are. A list or map
+// that contains itself gives a slice or map that does too.
+func FromVal(value Val) any {
+  return fromValShared(value, map[any]any{})
+}
+
+// fromValShared is FromVal giving the lists and maps in converted, by their
+// data, the values they were already converted to.
+func fromValShared(value Val, converted map[any]any) any {
+  switch v := value.(type) {
+    case nil:
+      return nil
+    case *Number:
+      return v.value
+    case *StringVal:
+      return v.value
+    case *ListVal:
+      if result, ok := converted[v.data]; ok {
+        return result
+      }
+      elements := v.Elements()
+      result := make([]any, len(elements))
+      converted[v.data] = result
+      for idx, element := range elements {
+        result[idx] = fromValShared(element, converted)
+      }
+      return result
+    case *MapVal:
+      if result, ok := converted[v.data]; ok {
+        return result
+      }
+      result := make(map[string]any)
+      converted[v.data] = result
+      for _, key := range v.Keys() {
+        entry, _ := v.Get(key)
+        result[key] = fromValShared(entry, converted)
+      }
+      return result
+    case *GoObject:
+      return v.Pointer()
+  }
+  return value
+}
+
+// fromVal converts value to a Go value of type t.
+func fromVal(value Val, t reflect.Type) (reflect.Value, error) {
+  result := reflect.New(t).Elem()
+  // Vals are also assignable to any, which should get the natural value.
+  if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+    if natural := FromVal(value); natural != nil {
+      result.Set(reflect.ValueOf(natural))
+    }
+    return result, nil
+  }
+  if value != nil && reflect.TypeOf(value).AssignableTo(t) {
+    return reflect.ValueOf(value), nil
+  }
+  if object, ok := value.(*GoObject); ok {
+    if object.ptr.Type().AssignableTo(t) {
+      return object.ptr, nil
+    }
+    if object.ptr.Type().Elem().AssignableTo(t) {
+      return object.ptr.Elem(), nil
+    }
+  }
+
+  switch t.Kind() {
+    case reflect.Bool:
+      if value != nil {
+        result.SetBool(value.IsTrue())
+        return result, nil
+      }
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+      if n, ok := intOf(value); ok && !result.OverflowInt(int64(n)) {
+        result.SetInt(int64(n))
+        return result, nil
+      }
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+      if n, ok := intOf(value); ok && n >= 0 && !result.OverflowUint(uint64(n)) {
+        result.SetUint(uint64(n))
+        return result, nil
+      }
+    case reflect.Float32, reflect.Float64:
+      if num, ok := value.(*Number); ok {
+        switch n := num.value.(type) {
+          case int:
+            result.SetFloat(float64(n))
+          case float64:
+            result.SetFloat(n)
+        }
+        return result, nil
+      }
+    case reflect.String:
+      if s, ok := value.(*StringVal); ok {
+        result.SetString(s.value)
+        return result, nil
+      }
+    case reflect.Slice:
+      if list, ok := value.(*ListVal); ok {
+        elements := list.Elements()
+        result = reflect.MakeSlice(t, len(elements), len(elements))
+        for idx, element := range elements {
+          converted, err := fromVal(element, t.Elem())
+          if err != nil {
+            return result, fmt.Errorf("element %v: %w", idx, err)
+          }
+          result.Index(idx).Set(converted)
+        }
+        return result, nil
+      }
+    case reflect.Map:
+      if m, ok := value.(*MapVal); ok && t.Key().Kind() == reflect.String {
+        result = reflect.MakeMap(t)
+        for _, key := range m.Keys() {
+          entry, _ := m.Get(key)
+          converted, err := fromVal(entry, t.Elem())
+          if err != nil {
+            return result, fmt.Errorf("key %q: %w", key, err)
+          }
+          result.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), converted)
+        }
+        return result, nil
+      }
+  }
+  return result, fmt.Errorf("cannot use %v as %v", describe(value), t)
+}
+
+func intOf(value Val) (int, bool) {
+  if num, ok := value.(*Number); ok {
+    n, ok := num.value.(int)
+    return n, ok
+  }
+  return 0, false
+}
+
+// wrapFunc makes a built-in function of a Go func. Its arguments are
+// converted from Vals and its result back, a non-nil error it returns last
+// and a panic become errors at the call. Its results are converted with
+// allow and restricted, see toVal.
+func wrapFunc(name string, fn reflect.Value, allow []string, restricted bool) (*BuiltinFunction, error) {
+  t := fn.Type()
+  if t.IsVariadic() {
+    return nil, fmt.Errorf("cannot convert %v, variadic funcs are not supported", t)
+  }
+  returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+  results := t.NumOut()
+  if returnsError {
+    results -= 1
+  }
+  if results > 1 {
+    return nil, fmt.Errorf("cannot convert %v, funcs may only return a value and an error", t)
+  }
+
+  argNames := make([]string, t.NumIn())
+  for idx := range argNames {
+    argNames[idx] = fmt.Sprintf("arg%v", idx+1)
+  }
+  return NewBuiltinFunction(name, argNames, func(b *BuiltinFunction, args []Val, context Context) (result RTResult) {
+    in := make([]reflect.Value, len(args))
+    for idx, arg := range args {
+      converted, err := fromVal(arg, t.In(idx))
+      if err != nil {
+        return builtinResult(nil, b.Error(fmt.Sprintf("argument %v of '%v': %v", idx+1, name, err), context))
+      }
+      in[idx] = converted
+    }
+
+    defer func() {
+      if r := recover(); r != nil {
+        result = builtinResult(nil, b.Error(fmt.Sprintf("'%v' panicked: %v", name, r), context))
+      }
+    }()
+    out := fn.Call(in)
+    if returnsError {
+      if err, _ := out[len(out)-1].Interface().(error); err != nil {
+        return builtinResult(nil, b.Error(err.Error(), context))
+      }
+      out = out[:len(out)-1]
+    }
+    if len(out) == 0 {
+      return builtinResult(null(context), nil)
+    }
+    value, err := toVal(name, out[0].Interface(), allow, restricted)
+    if err != nil {
+      return builtinResult(nil, b.Error(fmt.Sprintf("result of '%v': %v", name, err), context))
+    }
+    return builtinResult(value.SetContext(&context), nil)
+  }), nil
+}
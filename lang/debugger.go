@@ -0,0 +1,343 @@
+package lang
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Debugger runs scripts under the control of commands read from the user. It
+// pauses before statements, when stepping or at a breakpoint, and when an
+// error is raised. While paused the call stack can be walked, the variables
+// of its frames shown and assigned and expressions evaluated in them.
+type Debugger struct {
+  // ReadLine reads a command, it returns false at the end of input.
+  ReadLine func(prompt string) (string, bool)
+  Out io.Writer
+
+  // Held while paused, tasks reaching a statement wait for it.
+  mu sync.Mutex
+  // The nodes of the blocks entered so far.
+  statements map[Node]bool
+  breakpoints map[breakpoint]bool
+  mode stepMode
+  // The depth of the frame next and out were given in.
+  depth int
+  // The file given to Run, breakpoints without a file are in it.
+  file string
+  cancel gocontext.CancelFunc
+  // The command an empty line repeats.
+  last string
+}
+
+type breakpoint struct {
+  file string
+  line int
+}
+
+type stepMode int
+
+const (
+  stepIn stepMode = iota
+  stepOver
+  stepOut
+  stepContinue
+  stepQuit
+)
+
+// debugFrame is a frame of the paused call stack and the place it is at.
+type debugFrame struct {
+  context *Context
+  pos Position
+}
+
+const debugHelp = `Commands:
+  s, step                  run to the next statement
+  n, next                  run to the next statement of this function or a caller
+  o, out                   run until this function returns
+  c, continue              run to the next breakpoint
+  b, break [[file:]line]   set a breakpoint, on the current line by default
+  clear [[file:]line]      remove a breakpoint
+  bt, backtrace            show the call stack
+  f, frame N               select frame N of the call stack
+  l, list                  show the source around the selected frame
+  vars                     show the variables of the selected frame
+  p, print EXPR            evaluate EXPR in the selected frame
+  set NAME = EXPR          assign a variable of the selected frame
+  q, quit                  stop the program
+An empty line repeats the last command.
+`
+
+func NewDebugger(readLine func(prompt string) (string, bool), out io.Writer) *Debugger {
+  return &Debugger{
+    ReadLine: readLine,
+    Out: out,
+    statements: make(map[Node]bool),
+    breakpoints: make(map[breakpoint]bool),
+  }
+}
+
+// Run runs text like RunWithOptions, paused before its first statement.
+// Breakpoints are kept from one run to the next. There is no error when the
+// user quits.
+func (d *Debugger) Run(fn string, text string, globals *SymbolTable, options Options) (any, *Error) {
+  ctx, cancel := gocontext.WithCancel(gocontext.Background())
+  defer cancel()
+  d.mu.Lock()
+  d.file, d.cancel, d.mode = fn, cancel, stepIn
+  d.mu.Unlock()
+
+  options.Hooks = d.Hooks()
+  result, err := RunContext(ctx, fn, text, globals, options)
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  if d.mode == stepQuit {
+    return nil, nil
+  }
+  return result, err
+}
+
+// Hooks returns the hooks the debugger runs a script with.
+func (d *Debugger) Hooks() *Hooks {
+  return &Hooks{OnNodeEnter: d.enter, OnError: d.raised}
+}
+
+func (d *Debugger) enter(node Node, context *Context) {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  if block, ok := node.(*StatementsNode); ok {
+    for _, statement := range block.Statements {
+      d.statements[statement] = true
+    }
+    return
+  }
+  if !d.statements[node] || d.mode == stepQuit {
+    return
+  }
+
+  pos := node.GetPosStart()
+  stop := d.breakpoints[breakpoint{pos.fn, pos.ln + 1}]
+  switch d.mode {
+    case stepIn:
+      stop = true
+    case stepOver:
+      stop = stop || context.Depth <= d.depth
+    case stepOut:
+      stop = stop || context.Depth < d.depth
+  }
+  if stop {
+    d.pause(pos, context)
+  }
+}
+
+func (d *Debugger) raised(node Node, context *Context, err *Error) {
+  d.mu.Lock()
+  defer d.mu.Unlock()
+  if d.mode == stepQuit {
+    return
+  }
+  fmt.Fprintf(d.Out, "%v: %v\n", err.ErrorName, err.Details)
+  d.pause(err.PosStart, context)
+}
+
+// pause reads commands until one resumes the program.
+func (d *Debugger) pause(pos Position, context *Context) {
+  frames := []debugFrame{{context, pos}}
+  for c := context; c.Parent != nil && c.ParentEntryPos != nil && c.Parent.SymbolTable != nil; c = c.Parent {
+    frames = append(frames, debugFrame{c.Parent, *c.ParentEntryPos})
+  }
+  selected := 0
+  d.where(frames[0])
+
+  for {
+    line, ok := d.ReadLine("(debug) ")
+    if !ok {
+      d.quit()
+      return
+    }
+    line = strings.TrimSpace(line)
+    if line == "" {
+      line = d.last
+    }
+    d.last = line
+    command, arg, _ := strings.Cut(line, " ")
+    arg = strings.TrimSpace(arg)
+    frame := frames[selected]
+
+    switch command {
+      case "":
+      case "s", "step":
+        d.mode = stepIn
+        return
+      case "n", "next":
+        d.mode, d.depth = stepOver, context.Depth
+        return
+      case "o", "out":
+        d.mode, d.depth = stepOut, context.Depth
+        return
+      case "c", "continue":
+        d.mode = stepContinue
+        return
+      case "q", "quit":
+        d.quit()
+        return
+      case "b", "break":
+        d.breakpoint(arg, pos, true)
+      case "clear":
+        d.breakpoint(arg, pos, false)
+      case "bt", "backtrace":
+        for idx, frame := range frames {
+          marker := " "
+          if idx == selected {
+            marker = ">"
+          }
+          fmt.Fprintf(d.Out, "%v #%v %v at %v:%v\n", marker, idx, frame.context.DisplayName, frame.pos.fn, frame.pos.ln+1)
+          if frame.context.Elided > 0 {
+            fmt.Fprintf(d.Out, "    ... %v frame(s) elided by tail calls\n", frame.context.Elided)
+          }
+        }
+      case "f", "frame":
+        idx, err := strconv.Atoi(arg)
+        if err != nil || idx < 0 || idx >= len(frames) {
+          fmt.Fprintf(d.Out, "No frame '%v', the frames are 0 to %v\n", arg, len(frames)-1)
+          break
+        }
+        selected = idx
+        d.where(frames[idx])
+      case "l", "list":
+        lines := strings.Split(frame.pos.ftxt, "\n")
+        for ln := max(frame.pos.ln-3, 0); ln <= frame.pos.ln+3 && ln < len(lines); ln++ {
+          marker := " "
+          if ln == frame.pos.ln {
+            marker = ">"
+          } else if d.breakpoints[breakpoint{frame.pos.fn, ln + 1}] {
+            marker = "*"
+          }
+          fmt.Fprintf(d.Out, "%v %4v  %v\n", marker, ln+1, lines[ln])
+        }
+      case "vars":
+        d.vars(frame.context.SymbolTable)
+      case "p", "print":
+        value, err := d.eval(arg, frame.context)
+        if err != nil {
+          fmt.Fprintln(d.Out, err.AsString())
+        } else {
+          fmt.Fprintln(d.Out, describe(value))
+        }
+      case "set":
+        d.set(arg, frame.context)
+      case "h", "help":
+        fmt.Fprint(d.Out, debugHelp)
+      default:
+        fmt.Fprintf(d.Out, "Unknown command '%v', try 'help'\n", command)
+    }
+  }
+}
+
+func (d *Debugger) quit() {
+  d.mode = stepQuit
+  d.cancel()
+}
+
+func (d *Debugger) where(frame debugFrame) {
+  fmt.Fprintf(d.Out, "%v:%v in %v\n", frame.pos.fn, frame.pos.ln+1, frame.context.DisplayName)
+  lines := strings.Split(frame.pos.ftxt, "\n")
+  if frame.pos.ln < len(lines) {
+    fmt.Fprintf(d.Out, "  %v\n", strings.TrimSpace(lines[frame.pos.ln]))
+  }
+}
+
+// breakpoint sets or clears the breakpoint arg, [file:]line, or the one on
+// the line of pos when it is empty.
+func (d *Debugger) breakpoint(arg string, pos Position, set bool) {
+  bp := breakpoint{pos.fn, pos.ln + 1}
+  if arg != "" {
+    file, lineText := d.file, arg
+    if idx := strings.LastIndex(arg, ":"); idx >= 0 {
+      file, lineText = arg[:idx], arg[idx+1:]
+    }
+    line, err := strconv.Atoi(lineText)
+    if err != nil || line < 1 {
+      fmt.Fprintf(d.Out, "Expected [file:]line, got '%v'\n", arg)
+      return
+    }
+    bp = breakpoint{file, line}
+  }
+
+  if set {
+    d.breakpoints[bp] = true
+    fmt.Fprintf(d.Out, "Breakpoint at %v:%v\n", bp.file, bp.line)
+  } else if d.breakpoints[bp] {
+    delete(d.breakpoints, bp)
+    fmt.Fprintf(d.Out, "Cleared breakpoint at %v:%v\n", bp.file, bp.line)
+  } else {
+    fmt.Fprintf(d.Out, "No breakpoint at %v:%v\n", bp.file, bp.line)
+  }
+}
+
+// vars shows the variables of a frame, those of the loop iterations it is in
+// included. Built-ins are left out.
+func (d *Debugger) vars(table *SymbolTable) {
+  for ; table != nil; table = table.Parent {
+    for _, name := range table.Names() {
+      symbol := table.Lookup(name)
+      if symbol == nil || symbol.Const && symbol.DeclPos == nil {
+        continue
+      }
+      fmt.Fprintf(d.Out, "%v = %v\n", name, describe(symbol.Value))
+    }
+    if !table.Iteration {
+      return
+    }
+  }
+}
+
+// eval evaluates text in the frame of context. It runs without hooks, so it
+// cannot pause.
+func (d *Debugger) eval(text string, context *Context) (Val, *Error) {
+  node, err := Parse("<debug>", text)
+  if err != nil {
+    return nil, err
+  }
+  Resolve(node)
+  frame := Context{DisplayName: "<debug>", SymbolTable: context.SymbolTable, Depth: context.Depth}
+  interpreter := Interpreter{}
+  res := interpreter.Visit(node, frame)
+  if res.error != nil {
+    return nil, res.error
+  }
+  value, _ := res.value.(Val)
+  return value, nil
+}
+
+// set assigns a variable where it is declared, arg is NAME = EXPR.
+func (d *Debugger) set(arg string, context *Context) {
+  name, expr, ok := strings.Cut(arg, "=")
+  name = strings.TrimSpace(name)
+  if !ok || name == "" || strings.ContainsAny(name, " \t") {
+    fmt.Fprintln(d.Out, "Expected NAME = EXPR")
+    return
+  }
+  for table := context.SymbolTable; table != nil; table = table.Parent {
+    symbol := table.Lookup(name)
+    if symbol == nil {
+      continue
+    }
+    if symbol.Const {
+      fmt.Fprintf(d.Out, "Cannot reassign constant '%v'\n", name)
+      return
+    }
+    value, err := d.eval(expr, context)
+    if err != nil {
+      fmt.Fprintln(d.Out, err.AsString())
+      return
+    }
+    table.Set(name, value)
+    fmt.Fprintf(d.Out, "%v = %v\n", name, describe(value))
+    return
+  }
+  fmt.Fprintf(d.Out, "'%v' is not defined\n", name)
+}
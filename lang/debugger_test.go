@@ -0,0 +1,104 @@
+package lang
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const debugScript = `fn add(a, b) {
+  var s = a + b
+  s
+}
+var x = 1
+var y = add(x, 2)
+y * 10
+`
+
+var pausedAt = regexp.MustCompile(`(?m)^<test>:(\d+) in (\S+)$`)
+
+// debug runs debugScript reading commands from the script commands, and
+// gives where it paused, as line:function, and what it printed.
+func debug(t *testing.T, commands ...string) (result any, paused []string, out string) {
+  t.Helper()
+  var sb strings.Builder
+  readLine := func(prompt string) (string, bool) {
+    if len(commands) == 0 {
+      return "", false
+    }
+    command := commands[0]
+    commands = commands[1:]
+    return command, true
+  }
+  debugger := NewDebugger(readLine, &sb)
+  result, err := debugger.Run("<test>", debugScript, NewGlobals(), Options{})
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(commands) > 0 {
+    t.Errorf("commands left over: %v", commands)
+  }
+  for _, match := range pausedAt.FindAllStringSubmatch(sb.String(), -1) {
+    paused = append(paused, match[1]+":"+match[2])
+  }
+  return result, paused, sb.String()
+}
+
+func TestDebuggerStepping(t *testing.T) {
+  tests := []struct {
+    commands []string
+    paused string
+  }{
+    // step goes into calls, next over them.
+    {[]string{"s", "s", "s", "s", "c"}, "1:<program> 5:<program> 6:<program> 2:add 3:add"},
+    {[]string{"n", "n", "n", "c"}, "1:<program> 5:<program> 6:<program> 7:<program>"},
+    // An empty line repeats the last command.
+    {[]string{"n", "", "", "c"}, "1:<program> 5:<program> 6:<program> 7:<program>"},
+    {[]string{"s", "s", "s", "o", "c"}, "1:<program> 5:<program> 6:<program> 2:add 7:<program>"},
+    {[]string{"c"}, "1:<program>"},
+  }
+  for _, test := range tests {
+    result, paused, out := debug(t, test.commands...)
+    if got := strings.Join(paused, " "); got != test.paused {
+      t.Errorf("%v: paused at %v, want %v\n%v", test.commands, got, test.paused, out)
+    }
+    if fmt.Sprint(result) != "30" {
+      t.Errorf("%v: got %v", test.commands, result)
+    }
+  }
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+  // A breakpoint in a function stops in its frame, where its variables and
+  // those of its callers can be printed.
+  result, paused, out := debug(t, "b 3", "c", "p s + 1", "vars", "bt", "f 1", "p x", "c")
+  if got := strings.Join(paused, " "); got != "1:<program> 3:add 6:<program>" {
+    t.Errorf("paused at %v\n%v", got, out)
+  }
+  for _, want := range []string{"Breakpoint at <test>:3\n", "\n4\n", "a = 1\nb = 2\ns = 3\n", "> #0 add at <test>:3\n", "  #1 <program> at <test>:6\n", "\n1\n"} {
+    if !strings.Contains(out, want) {
+      t.Errorf("output lacks %q\n%v", want, out)
+    }
+  }
+  if fmt.Sprint(result) != "30" {
+    t.Errorf("got %v", result)
+  }
+
+  // Cleared breakpoints no longer stop, set changes what the program sees.
+  result, paused, out = debug(t, "b 2", "b 3", "clear 2", "c", "set s = 5", "c")
+  if got := strings.Join(paused, " "); got != "1:<program> 3:add" {
+    t.Errorf("paused at %v\n%v", got, out)
+  }
+  if fmt.Sprint(result) != "50" {
+    t.Errorf("got %v", result)
+  }
+}
+
+func TestDebuggerQuit(t *testing.T) {
+  for _, commands := range [][]string{{"q"}, {"s"}} {
+    if result, _, out := debug(t, commands...); result != nil {
+      t.Errorf("%v: got %v\n%v", commands, result, out)
+    }
+  }
+}
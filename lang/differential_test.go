@@ -0,0 +1,62 @@
+package lang
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// outcome is what a run of a program left behind: what it printed, its error
+// and the globals it defined.
+func outcome(t *testing.T, path string, options Options) string {
+  t.Helper()
+  text, readErr := os.ReadFile(path)
+  if readErr != nil {
+    t.Fatal(readErr)
+  }
+  globals := NewGlobals()
+  var out bytes.Buffer
+  options.Stdout = &out
+  result, err := RunWithOptions(path, string(text), globals, options)
+
+  lines := []string{"output: " + out.String()}
+  if err != nil {
+    lines = append(lines, "error: "+err.AsString())
+  } else if value, ok := result.(Val); ok {
+    lines = append(lines, "result: "+value.String())
+  }
+  for _, name := range globals.Names() {
+    symbol := globals.Lookup(name)
+    if symbol.Const && symbol.DeclPos == nil {
+      continue
+    }
+    lines = append(lines, fmt.Sprintf("%v = %v", name, describe(symbol.Value)))
+  }
+  return strings.Join(lines, "\n")
+}
+
+// TestDifferential runs the programs in testdata on the interpreter and on
+// the VM, which must print the same, leave the same globals and fail with the
+// same errors.
+func TestDifferential(t *testing.T) {
+  paths, err := filepath.Glob("testdata/*.scv")
+  if err != nil || len(paths) == 0 {
+    t.Fatalf("no programs in testdata: %v", err)
+  }
+  for _, path := range paths {
+    t.Run(filepath.Base(path), func(t *testing.T) {
+      walked := outcome(t, path, Options{})
+      compiled := outcome(t, path, Options{VM: true})
+      if walked != compiled {
+        t.Errorf("interpreter:\n%v\n\nVM:\n%v", walked, compiled)
+      }
+      failed := strings.Contains(walked, "\nerror: ")
+      if expectError := strings.HasPrefix(filepath.Base(path), "error_"); failed != expectError {
+        t.Errorf("unexpected outcome:\n%v", walked)
+      }
+    })
+  }
+}
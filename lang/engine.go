@@ -0,0 +1,151 @@
+package lang
+
+import (
+	gocontext "context"
+	"fmt"
+	"reflect"
+)
+
+// Engine runs scripts for a Go program. The globals it runs them with start
+// out as NewGlobals and keep what the scripts and Set and Register add, so a
+// script sees the definitions of the ones before it. Scripts can only import
+// modules when Options has an Importer, such as one of ImportsFrom, they are
+// imported once for all of its runs unless Options names a cache. Scripts
+// print to Options.Stdout and read input from Options.Stdin.
+type Engine struct {
+  Options Options
+  globals *SymbolTable
+  modules *ModuleCache
+}
+
+func NewEngine() *Engine {
+  return &Engine{globals: NewGlobals(), modules: NewModuleCache()}
+}
+
+func (e *Engine) options() Options {
+  options := e.Options
+  if options.Modules == nil {
+    options.Modules = e.modules
+  }
+  if options.Importer == nil {
+    options.Importer = noImports
+  }
+  return options
+}
+
+// Globals is the symbol table the engine runs scripts with.
+func (e *Engine) Globals() *SymbolTable {
+  return e.globals
+}
+
+// Set makes value, converted with ToVal, the global name. Constants such as
+// true and the built-ins cannot be replaced, by Register and Expose either.
+func (e *Engine) Set(name string, value any) error {
+  converted, err := toVal(name, value, nil, false)
+  if err != nil {
+    return fmt.Errorf("cannot set '%v': %w", name, err)
+  }
+  return e.define("set", name, converted)
+}
+
+// define makes value the global name unless that is a constant, such as true
+// or a built-in.
+func (e *Engine) define(verb string, name string, value Val) error {
+  if symbol := e.globals.Lookup(name); symbol != nil && symbol.Const {
+    return fmt.Errorf("cannot %v '%v': it is a constant", verb, name)
+  }
+  e.globals.Set(name, value)
+  return nil
+}
+
+// Register makes the Go func fn the global function name. Its arguments
+// and result are converted like Set converts values, it may return an
+// error last, which the script sees as a runtime error at the call.
+func (e *Engine) Register(name string, fn any) error {
+  rv := reflect.ValueOf(fn)
+  if rv.Kind() != reflect.Func || rv.IsNil() {
+    return fmt.Errorf("cannot register '%v': %T is not a func", name, fn)
+  }
+  builtin, err := wrapFunc(name, rv, nil, false)
+  if err != nil {
+    return fmt.Errorf("cannot register '%v': %w", name, err)
+  }
+  return e.define("register", name, builtin)
+}
+
+// Expose makes the struct ptr points to the global name, as a GoObject that
+// only shows the fields and methods allow lists, or all of them when there
+// are none. See NewGoObject for the fields of nested structs.
+func (e *Engine) Expose(name string, ptr any, allow ...string) error {
+  object, err := NewGoObject(ptr, allow...)
+  if err != nil {
+    return fmt.Errorf("cannot expose '%v': %w", name, err)
+  }
+  return e.define("expose", name, object)
+}
+
+// Get returns the global name converted with FromVal.
+func (e *Engine) Get(name string) (any, bool) {
+  value := e.globals.Get(name)
+  if value == nil {
+    return nil, false
+  }
+  return FromVal(value), true
+}
+
+// Call calls the global function name, with args converted by ToVal, and
+// returns its result converted by FromVal. Each call gets the engine's
+// budgets to itself. The error of a failed call is a *Error whose text has
+// the traceback.
+func (e *Engine) Call(name string, args ...any) (any, error) {
+  return e.CallContext(gocontext.Background(), name, args...)
+}
+
+func (e *Engine) CallContext(ctx gocontext.Context, name string, args ...any) (any, error) {
+  value := e.globals.Get(name)
+  if value == nil {
+    return nil, fmt.Errorf("cannot call '%v': not defined", name)
+  }
+  callee, ok := value.(Callable)
+  if !ok {
+    return nil, fmt.Errorf("cannot call '%v': %v is not callable", name, describe(value))
+  }
+  return callFromGo(ctx, callee, e.options(), args)
+}
+
+func callFromGo(ctx gocontext.Context, callee Callable, options Options, args []any) (any, error) {
+  converted := make([]Val, len(args))
+  for idx, arg := range args {
+    value, err := ToVal(arg)
+    if err != nil {
+      return nil, fmt.Errorf("argument %v: %w", idx+1, err)
+    }
+    converted[idx] = value
+  }
+  caller := Context{DisplayName: "<go>", run: newRunState(ctx, options)}
+  defer caller.run.finish()
+  res := callee.Execute(converted, &caller)
+  if options.Stats != nil {
+    *options.Stats = caller.run.stats()
+  }
+  if res.error != nil {
+    return nil, res.error
+  }
+  value, _ := res.value.(Val)
+  return FromVal(value), nil
+}
+
+// Run runs text, fn is the file name errors show. The result is the value
+// of the last statement converted with FromVal, the error a *Error.
+func (e *Engine) Run(fn string, text string) (any, error) {
+  return e.RunContext(gocontext.Background(), fn, text)
+}
+
+func (e *Engine) RunContext(ctx gocontext.Context, fn string, text string) (any, error) {
+  result, err := RunContext(ctx, fn, text, e.globals, e.options())
+  if err != nil {
+    return nil, err
+  }
+  value, _ := result.(Val)
+  return FromVal(value), nil
+}
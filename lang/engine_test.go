@@ -0,0 +1,220 @@
+package lang
+
+import (
+	gocontext "context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testAddress struct {
+  City string
+  Zip string
+}
+
+type testCustomer struct {
+  Name string
+  Secret string
+  Address testAddress
+}
+
+func TestExposeNestedStructs(t *testing.T) {
+  customer := &testCustomer{Name: "Ada", Secret: "hunter2", Address: testAddress{City: "London", Zip: "N1"}}
+  tests := []struct {
+    allow []string
+    text string
+    want string
+  }{
+    {nil, "customer.address.zip", "N1"},
+    {[]string{"name", "address.city"}, "customer.address.city", "London"},
+    {[]string{"name", "address.city"}, "customer.address.zip", "has no field 'zip'"},
+    {[]string{"name", "address.city"}, "customer.secret", "has no field 'secret'"},
+    // Allowing the struct alone shows none of its fields.
+    {[]string{"address"}, "customer.address.city", "has no field 'city'"},
+  }
+  for _, test := range tests {
+    engine := NewEngine()
+    if err := engine.Expose("customer", customer, test.allow...); err != nil {
+      t.Fatal(err)
+    }
+    result, err := engine.Run("<test>", test.text)
+    got := ""
+    if err != nil {
+      got = err.Error()
+    } else {
+      got, _ = result.(string)
+    }
+    if !strings.Contains(got, test.want) {
+      t.Errorf("%v with %v: got %q, want %q", test.text, test.allow, got, test.want)
+    }
+  }
+
+  // Writes through an allowed path reach the struct.
+  engine := NewEngine()
+  if err := engine.Expose("customer", customer, "address.city"); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := engine.Run("<test>", "customer.address.city = \"Paris\""); err != nil {
+    t.Fatal(err)
+  }
+  if customer.Address.City != "Paris" {
+    t.Errorf("city is %v", customer.Address.City)
+  }
+
+  for _, allow := range []string{"address.country", "name.first", "nothing"} {
+    if err := NewEngine().Expose("customer", customer, allow); err == nil {
+      t.Errorf("allowing %v: expected an error", allow)
+    }
+  }
+}
+
+type testAccount struct {
+  Owner *testCustomer
+  Secret string
+}
+
+func (a *testAccount) Self() *testAccount {
+  return a
+}
+
+func (a *testAccount) Customers() []testCustomer {
+  return []testCustomer{*a.Owner}
+}
+
+func TestExposeKeepsRestrictions(t *testing.T) {
+  account := &testAccount{Owner: &testCustomer{Name: "Ada", Secret: "hunter2"}, Secret: "1234"}
+  tests := []struct {
+    allow []string
+    text string
+    want string
+  }{
+    // Structs that fields point to show what the allow list names of them.
+    {[]string{"owner.name"}, "account.owner.name", "Ada"},
+    {[]string{"owner.name"}, "account.owner.secret", "has no field 'secret'"},
+    {[]string{"owner"}, "account.owner.name", "has no field 'name'"},
+    {[]string{"owner"}, "account.owner.secret = \"x\"", "has no field 'secret'"},
+    // The structs methods return show nothing.
+    {[]string{"self"}, "account.self().secret", "has no field 'secret'"},
+    {[]string{"self"}, "account.self().secret = \"x\"", "has no field 'secret'"},
+    {[]string{"customers"}, "len(account.customers())", "1"},
+    {[]string{"customers"}, "account.customers().get(0).secret", "has no field 'secret'"},
+    // Without an allow list everything is shown.
+    {nil, "account.self().owner.secret", "hunter2"},
+  }
+  for _, test := range tests {
+    engine := NewEngine()
+    if err := engine.Expose("account", account, test.allow...); err != nil {
+      t.Fatal(err)
+    }
+    result, err := engine.Run("<test>", test.text)
+    got := ""
+    if err != nil {
+      got = err.Error()
+    } else {
+      got = fmt.Sprint(result)
+    }
+    if !strings.Contains(got, test.want) {
+      t.Errorf("%v with %v: got %q, want %q", test.text, test.allow, got, test.want)
+    }
+  }
+  if account.Secret != "1234" || account.Owner.Secret != "hunter2" {
+    t.Errorf("a script changed %+v", account)
+  }
+  if err := NewEngine().Expose("account", account, "self.secret"); err == nil {
+    t.Error("allowing a path below a method: expected an error")
+  }
+}
+
+func TestEngineKeepsConstants(t *testing.T) {
+  engine := NewEngine()
+  if err := engine.Set("true", 0); err == nil {
+    t.Error("Set replaced true")
+  }
+  if err := engine.Register("print", func(s string) {}); err == nil {
+    t.Error("Register replaced print")
+  }
+  if err := engine.Expose("len", &testAddress{}); err == nil {
+    t.Error("Expose replaced len")
+  }
+  if _, err := engine.Run("<test>", "const limit = 3"); err != nil {
+    t.Fatal(err)
+  }
+  if err := engine.Set("limit", 4); err == nil {
+    t.Error("Set replaced a constant of the script")
+  }
+  if result, err := engine.Run("<test>", "if true { limit } else { 0 }"); err != nil || result != 3 {
+    t.Errorf("got %v, %v", result, err)
+  }
+  if err := engine.Set("limits", 4); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestCallsFromGoHaveTheirOwnOptions(t *testing.T) {
+  var runStats, callStats Stats
+  var calls int
+  hooks := &Hooks{OnCall: func(node Node, context *Context, callee Val, args []Val) { calls += 1 }}
+  engine := NewEngine()
+  engine.Options = Options{Stats: &runStats, Hooks: hooks}
+  if _, err := engine.Run("<test>", "fn count(n) { var i = 0; while i < n { var i = i + 1 }; i }"); err != nil {
+    t.Fatal(err)
+  }
+  value, _ := engine.Get("count")
+  count := value.(*Function)
+  ranFor, before := runStats, calls
+
+  // A call with the options of the run that defined the function leaves its
+  // stats and hooks alone.
+  if result, err := count.Call(10); err != nil || result != 10 {
+    t.Fatalf("got %v, %v", result, err)
+  }
+  if runStats != ranFor || calls != before {
+    t.Errorf("the call used the stats or hooks of the run")
+  }
+
+  result, err := count.CallWithOptions(gocontext.Background(), Options{Stats: &callStats, MaxSteps: 100}, 10)
+  if err != nil || result != 10 {
+    t.Fatalf("got %v, %v", result, err)
+  }
+  if callStats.Steps < 10 || callStats.Memory == 0 {
+    t.Errorf("stats of the call %+v", callStats)
+  }
+  if _, err := count.CallWithOptions(gocontext.Background(), Options{MaxSteps: 5}, 10); err == nil {
+    t.Error("the steps of the call were not limited")
+  }
+
+  engine.Options = Options{Stats: &callStats}
+  if _, err := engine.Call("count", 20); err != nil {
+    t.Fatal(err)
+  }
+  if callStats.Steps < 20 {
+    t.Errorf("Engine.Call filled in %+v", callStats)
+  }
+}
+
+func TestRegisteredAnyGetsGoValues(t *testing.T) {
+  var got []any
+  engine := NewEngine()
+  if err := engine.Register("keep", func(value any) { got = append(got, value) }); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := engine.Run("<test>", "keep(1); keep(1.5); keep(\"s\"); keep(keep)"); err != nil {
+    t.Fatal(err)
+  }
+  if len(got) != 4 {
+    t.Fatalf("got %v", got)
+  }
+  if _, ok := got[0].(int); !ok {
+    t.Errorf("1 is %T", got[0])
+  }
+  if _, ok := got[1].(float64); !ok {
+    t.Errorf("1.5 is %T", got[1])
+  }
+  if _, ok := got[2].(string); !ok {
+    t.Errorf("\"s\" is %T", got[2])
+  }
+  // Values without a Go counterpart stay Vals.
+  if _, ok := got[3].(*BuiltinFunction); !ok {
+    t.Errorf("keep is %T", got[3])
+  }
+}
@@ -2,6 +2,7 @@ package lang
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -45,37 +46,141 @@ type Error struct {
 	Details   string
   Type string
   Context *Context
+  Note string
+  // Whether Hooks.OnError was called for it.
+  reported bool
 }
 
 func (e *Error) AsString() string {
-  if e.Type == "rterror" && e.Context != nil {
+  // Errors of built-ins called from Go have no place in a script.
+  if e.PosStart.ftxt == "" {
+    return fmt.Sprintf("%v: %v", e.ErrorName, e.Details)
+  }
+  if (e.Type == "rterror" || e.Interrupted()) && e.Context != nil {
     result := e.GenerateTraceback()
 	  result += fmt.Sprintf("%v: %v", e.ErrorName, e.Details)
 	  result += "\n\n" + stringWithArrows(e.PosStart.ftxt, e.PosStart, e.PosEnd)
-	  return result
+	  return result + e.Note
   }
 	result := fmt.Sprintf("%v: %v", e.ErrorName, e.Details)
 	result += "\n" + fmt.Sprintf("(File: %v, Line: %v)", e.PosStart.fn, e.PosEnd.ln+1)
 	result += "\n\n" + stringWithArrows(e.PosStart.ftxt, e.PosStart, e.PosEnd)
-	return result
+	return result + e.Note
+}
+
+// Error makes *Error an error, its text is that of AsString.
+func (e *Error) Error() string {
+  return e.AsString()
 }
 
 func (e *Error) GenerateTraceback() string {
-  result := ""
+  lines := []string{}
   pos := e.PosStart
   ctx := e.Context
 
-  for ctx != nil {
-    result = fmt.Sprintf("  (File %v, line %v, in %v)\n", pos.fn, pos.ln+1, ctx.DisplayName) + result
+  // Contexts without a symbol table are Go code calling into the script,
+  // there is no line to show for them.
+  for ctx != nil && ctx.SymbolTable != nil {
+    lines = append(lines, fmt.Sprintf("  (File %v, line %v, in %v)\n", pos.fn, pos.ln+1, ctx.DisplayName))
+    if ctx.Elided > 0 {
+      lines = append(lines, fmt.Sprintf("  ... %v frame(s) elided by tail calls\n", ctx.Elided))
+    }
     if ctx.ParentEntryPos == nil {
       break
     }
     pos = *ctx.ParentEntryPos
     ctx = ctx.Parent
   }
+
+  slices.Reverse(lines)
+
+  // Runaway recursion repeats the same lines, or the same few lines for
+  // mutual recursion, show them a few times only.
+  result := ""
+  for idx := 0; idx < len(lines); {
+    period, count := repetition(lines, idx)
+    if count <= 3 {
+      result += lines[idx]
+      idx += 1
+      continue
+    }
+    result += strings.Repeat(strings.Join(lines[idx:idx+period], ""), 3)
+    if period == 1 {
+      result += fmt.Sprintf("  [Previous line repeated %v more times]\n", count-3)
+    } else {
+      result += fmt.Sprintf("  [Previous %v lines repeated %v more times]\n", period, count-3)
+    }
+    idx += period * count
+  }
+  if result == "" {
+    return ""
+  }
   return "Traceback (most recent call last):\n" + result
 }
 
+// maxCycle is the longest run of lines a traceback condenses.
+const maxCycle = 10
+
+// repetition finds the run of lines starting at start that repeats right
+// after itself most, it returns its length and how often it is there.
+func repetition(lines []string, start int) (int, int) {
+  bestPeriod, bestCount := 1, 1
+  for period := 1; period <= maxCycle && start+2*period <= len(lines); period++ {
+    count := 1
+    for next := start + period; next+period <= len(lines); next += period {
+      same := true
+      for offset := range period {
+        if lines[next+offset] != lines[start+offset] {
+          same = false
+          break
+        }
+      }
+      if !same {
+        break
+      }
+      count += 1
+    }
+    if count > 3 && count*period > bestCount*bestPeriod {
+      bestPeriod, bestCount = period, count
+    }
+  }
+  return bestPeriod, bestCount
+}
+
+// Interrupted reports whether the run was stopped by its host, through the
+// step limit, the timeout or cancellation, rather than by an error in the
+// script.
+func (e *Error) Interrupted() bool {
+  return e.Type == "interrupt"
+}
+
+func InterruptError(posStart, posEnd Position, details string, context Context) *Error {
+	return &Error{
+		PosStart:  posStart,
+		PosEnd:    posEnd,
+		ErrorName: "Interrupted",
+		Details:   details,
+    Type: "interrupt",
+    Context: &context,
+	}
+}
+
+// Exited reports whether the script called exit.
+func (e *Error) Exited() bool {
+  return e.Type == "exit"
+}
+
+func ExitError(posStart, posEnd Position, context Context) *Error {
+	return &Error{
+		PosStart:  posStart,
+		PosEnd:    posEnd,
+		ErrorName: "Exit",
+		Details:   "exit called",
+    Type: "exit",
+    Context: &context,
+	}
+}
+
 func IllegalCharError(posStart, posEnd Position, details string) *Error {
 	return &Error{
 		PosStart:  posStart,
@@ -116,3 +221,18 @@ func RTError(posStart, posEnd Position, details string, context Context) *Error
     Context: &context,
 	}
 }
+
+func ConstAssignError(posStart, posEnd Position, name string, declPos *Position, context Context) *Error {
+  err := RTError(posStart, posEnd, fmt.Sprintf("Cannot reassign constant '%v'", name), context)
+  if declPos == nil {
+    err.Details += " (built-in)"
+  } else {
+    declEnd := declPos.Copy()
+    for range len(name) {
+      declEnd.Advance()
+    }
+    err.Note = fmt.Sprintf("\n'%v' was declared here (File %v, line %v):\n", name, declPos.fn, declPos.ln+1)
+    err.Note += stringWithArrows(declPos.ftxt, *declPos, declEnd)
+  }
+  return err
+}
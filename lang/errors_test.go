@@ -0,0 +1,82 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTracebackCondensesCycles(t *testing.T) {
+  tests := []struct {
+    text string
+    // The frames the traceback shows, one per line, and its note.
+    frames []string
+    note string
+  }{
+    {
+      "fn f(x) { f(x) + 1 }\nf(1)",
+      []string{"<program>", "f", "f", "f"},
+      "  [Previous line repeated 997 more times]",
+    },
+    {
+      "fn even(n) { odd(n) + 0 }\nfn odd(n) { even(n) + 0 }\neven(1)",
+      []string{"<program>", "even", "odd", "even", "odd", "even", "odd"},
+      "  [Previous 2 lines repeated 497 more times]",
+    },
+    {
+      "fn a() { b() + 0 }\nfn b() { c() + 0 }\nfn c() { a() + 0 }\nfn start() { a() + 0 }\nstart()",
+      []string{"<program>", "start", "a", "b", "c", "a", "b", "c", "a", "b", "c"},
+      "  [Previous 3 lines repeated 330 more times]",
+    },
+  }
+  for _, test := range tests {
+    for _, vm := range []bool{false, true} {
+      _, err := RunWithOptions("<test>", test.text, NewGlobals(), Options{VM: vm})
+      if err == nil {
+        t.Fatalf("%q: expected an error", test.text)
+      }
+      frames := []string{}
+      note := ""
+      for _, line := range strings.Split(err.GenerateTraceback(), "\n") {
+        if _, name, ok := strings.Cut(line, ", in "); ok {
+          frames = append(frames, strings.TrimSuffix(name, ")"))
+        } else if strings.HasPrefix(line, "  [") {
+          note = line
+        }
+      }
+      if strings.Join(frames, " ") != strings.Join(test.frames, " ") || note != test.note {
+        t.Errorf("%q (vm %v): traceback\n%v", test.text, vm, err.GenerateTraceback())
+      }
+    }
+  }
+}
+
+func TestTracebackKeepsShortRepeats(t *testing.T) {
+  text := "fn f(n) { if n == 0 { 1 / 0 } else { f(n - 1) + 0 } }\nf(2)"
+  _, err := RunWithOptions("<test>", text, NewGlobals(), Options{})
+  if err == nil {
+    t.Fatal("expected an error")
+  }
+  traceback := err.GenerateTraceback()
+  if strings.Count(traceback, "in f)") != 3 || strings.Contains(traceback, "repeated") {
+    t.Errorf("three frames should be shown as they are:\n%v", traceback)
+  }
+}
+
+func TestTailCallLimit(t *testing.T) {
+  text := "fn f(x) { f(x) }\nf(1)"
+  for _, vm := range []bool{false, true} {
+    _, err := RunWithOptions("<test>", text, NewGlobals(), Options{VM: vm, MaxTailCalls: 100})
+    if err == nil || err.Details != "maximum recursion depth exceeded" {
+      t.Fatalf("vm %v: got %v, want the recursion limit", vm, err)
+    }
+    if !strings.Contains(err.GenerateTraceback(), "... 100 frame(s) elided by tail calls") {
+      t.Errorf("vm %v: traceback\n%v", vm, err.GenerateTraceback())
+    }
+  }
+
+  // Tail recursion within the limit runs in constant depth.
+  text = "fn count(n, acc) { if n == 0 { return acc }; return count(n - 1, acc + 1) }\ncount(5000, 0)"
+  if got := evalBoth(t, text); got != "5000" {
+    t.Errorf("count = %v, want 5000", got)
+  }
+}
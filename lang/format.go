@@ -0,0 +1,424 @@
+package lang
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const indentUnit = "  "
+
+func Format(fn string, text string) (string, *Error) {
+  lexer := NewLexer(fn, text)
+  tokens, err := lexer.MakeTokens()
+  if err != nil {
+    return "", err
+  }
+
+  parser := NewParser(tokens)
+  ast := parser.Parse()
+  if ast.error != nil {
+    return "", ast.error
+  }
+
+  p := &printer{comments: lexer.Comments, lastLine: -1}
+  root := ast.node.(*StatementsNode)
+  p.statements(root.Statements, root.PosEnd)
+  return p.out.String(), nil
+}
+
+type printer struct {
+  out strings.Builder
+  comments []Comment
+  next int
+  indent int
+  lastLine int
+}
+
+// ======= Layout =======
+func (p *printer) newline() {
+  p.out.WriteString("\n")
+}
+
+func (p *printer) writeIndent() {
+  p.out.WriteString(strings.Repeat(indentUnit, p.indent))
+}
+
+func (p *printer) separate(line int, first bool) {
+  if !first && p.lastLine >= 0 && line > p.lastLine+1 {
+    p.newline()
+  }
+}
+
+func (p *printer) flushComments(before Position, first bool) bool {
+  for p.next < len(p.comments) && p.comments[p.next].PosStart.idx < before.idx {
+    comment := p.comments[p.next]
+    p.separate(comment.PosStart.ln, first)
+    p.writeIndent()
+    p.out.WriteString(comment.Text)
+    p.newline()
+    p.lastLine = comment.PosStart.ln
+    p.next += 1
+    first = false
+  }
+  return first
+}
+
+func (p *printer) trailingComment() {
+  if p.next < len(p.comments) && p.comments[p.next].PosStart.ln == p.lastLine {
+    p.out.WriteString(" " + p.comments[p.next].Text)
+    p.next += 1
+  }
+}
+
+func (p *printer) hasCommentsIn(posStart, posEnd Position) bool {
+  for _, comment := range p.comments[p.next:] {
+    if comment.PosStart.idx >= posEnd.idx {
+      break
+    }
+    if comment.PosStart.idx >= posStart.idx {
+      return true
+    }
+  }
+  return false
+}
+
+func (p *printer) statements(statements []Node, end Position) {
+  first := true
+  for _, statement := range statements {
+    first = p.flushComments(statement.GetPosStart(), first)
+    p.separate(statement.GetPosStart().ln, first)
+    p.writeIndent()
+    p.node(statement, 0)
+    p.trailingComment()
+    p.newline()
+    first = false
+  }
+  p.flushComments(end, first)
+}
+
+func isSimple(node Node) bool {
+  simple := true
+  Inspect(node, func(n Node) bool {
+    switch n.(type) {
+      case *StatementsNode, *ClassDefNode:
+        simple = false
+    }
+    return simple
+  })
+  return simple
+}
+
+func (p *printer) canInline(blocks ...Node) bool {
+  for _, block := range blocks {
+    body := block.(*StatementsNode)
+    if len(body.Statements) > 1 || p.hasCommentsIn(body.PosStart, body.PosEnd) {
+      return false
+    }
+    if len(body.Statements) == 1 && !isSimple(body.Statements[0]) {
+      return false
+    }
+  }
+  return true
+}
+
+func (p *printer) block(node Node, inline bool) {
+  body := node.(*StatementsNode)
+  if len(body.Statements) == 0 && !p.hasCommentsIn(body.PosStart, body.PosEnd) {
+    p.out.WriteString("{}")
+    return
+  }
+  if inline {
+    p.out.WriteString("{ ")
+    p.node(body.Statements[0], 0)
+    p.out.WriteString(" }")
+    return
+  }
+
+  p.out.WriteString("{")
+  p.trailingComment()
+  p.newline()
+  p.indent += 1
+  p.statements(body.Statements, body.PosEnd)
+  p.indent -= 1
+  p.writeIndent()
+  p.out.WriteString("}")
+  p.lastLine = body.PosEnd.ln
+}
+
+// ======= Expressions =======
+func precedence(node Node) int {
+  switch n := node.(type) {
+    case *VarAssignNode, *FieldAssignNode:
+      return 0
+    case *BinOpNode:
+      if n.OpTok.type_ == KEYWORD {
+        return 1
+      }
+      switch n.OpTok.type_ {
+        case EE, NE, LT, GT, LTE, GTE:
+          return 3
+        case PLUS, MINUS:
+          return 4
+        case MUL, DIV:
+          return 5
+      }
+      return 7
+    case *UnaryOpNode:
+      if n.OpTok.Matches(KEYWORD, "not") {
+        return 2
+      }
+      return 6
+    case *SpawnNode, *AwaitNode:
+      return 6
+    case *CallNode, *FieldAccessNode:
+      return 8
+    case *NumberNode:
+      if strings.HasPrefix(formatNumber(n.Tok.value), "-") {
+        return 6
+      }
+  }
+  return 9
+}
+
+func formatNumber(value any) string {
+  switch v := value.(type) {
+    case float64:
+      result := strconv.FormatFloat(v, 'f', -1, 64)
+      if !strings.Contains(result, ".") {
+        result += ".0"
+      }
+      return result
+  }
+  return fmt.Sprintf("%v", value)
+}
+
+func quoteString(value string) string {
+  replacer := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t")
+  return "\"" + replacer.Replace(value) + "\""
+}
+
+func annotation(name string, typeTok Token, sep string) string {
+  if typeName, _ := typeTok.value.(string); typeName != "" {
+    return name + sep + typeName
+  }
+  return name
+}
+
+func (p *printer) node(node Node, minPrec int) {
+  if precedence(node) < minPrec {
+    p.out.WriteString("(")
+    p.node(node, 0)
+    p.out.WriteString(")")
+    return
+  }
+
+  switch n := node.(type) {
+    case *NumberNode:
+      p.out.WriteString(formatNumber(n.Tok.value))
+    case *StringNode:
+      p.out.WriteString(quoteString(n.Tok.value.(string)))
+    case *VarAccessNode:
+      p.out.WriteString(n.VarName.value.(string))
+    case *SuperNode:
+      p.out.WriteString("super")
+    case *VarAssignNode:
+      if n.IsConst {
+        p.out.WriteString("const ")
+      } else if !n.IsUpdate {
+        p.out.WriteString("var ")
+      }
+      p.out.WriteString(annotation(n.VarName.value.(string), n.TypeTok, ": ") + " = ")
+      p.node(n.ValueNode, 0)
+    case *BinOpNode:
+      prec := precedence(n)
+      if n.OpTok.type_ == POW {
+        p.node(n.LeftNode, 8)
+        p.out.WriteString(" ** ")
+        p.node(n.RightNode, 6)
+      } else {
+        p.node(n.LeftNode, prec)
+        p.out.WriteString(" " + n.OpTok.Symbol() + " ")
+        p.node(n.RightNode, prec+1)
+      }
+    case *UnaryOpNode:
+      if n.OpTok.Matches(KEYWORD, "not") {
+        p.out.WriteString("not ")
+        p.node(n.Node, 2)
+      } else {
+        p.out.WriteString(n.OpTok.Symbol())
+        p.node(n.Node, 6)
+      }
+    case *CallNode:
+      p.node(n.NodeToCall, 8)
+      p.out.WriteString("(")
+      for idx, arg := range n.ArgNodes {
+        if idx > 0 {
+          p.out.WriteString(", ")
+        }
+        p.node(arg, 0)
+      }
+      p.out.WriteString(")")
+    case *FieldAccessNode:
+      p.node(n.NodeToAccess, 8)
+      p.out.WriteString("." + n.FieldNameTok.value.(string))
+    case *FieldAssignNode:
+      p.node(n.NodeToAccess, 8)
+      p.out.WriteString("." + n.FieldNameTok.value.(string) + " = ")
+      p.node(n.ValueNode, 0)
+    case *YieldNode:
+      p.out.WriteString("yield ")
+      p.node(n.Node, 0)
+    case *SpawnNode:
+      p.out.WriteString("spawn ")
+      p.node(n.Call, 8)
+    case *AwaitNode:
+      p.out.WriteString("await ")
+      p.node(n.Node, 6)
+    case *ReturnNode:
+      p.out.WriteString("return")
+      if n.NodeToReturn != nil {
+        p.out.WriteString(" ")
+        p.node(n.NodeToReturn, 0)
+      }
+    case *IfNode:
+      blocks := []Node{}
+      for _, Case := range n.Cases {
+        blocks = append(blocks, Case[1])
+      }
+      if n.ElseCase != nil {
+        blocks = append(blocks, n.ElseCase)
+      }
+      inline := p.canInline(blocks...)
+      for idx, Case := range n.Cases {
+        if idx == 0 {
+          p.out.WriteString("if ")
+        } else {
+          p.out.WriteString(" elif ")
+        }
+        p.node(Case[0], 0)
+        p.out.WriteString(" ")
+        p.block(Case[1], inline)
+      }
+      if n.ElseCase != nil {
+        p.out.WriteString(" else ")
+        p.block(n.ElseCase, inline)
+      }
+    case *ForNode:
+      p.out.WriteString("for " + n.VarNameTok.value.(string))
+      if n.Iterable != nil {
+        p.out.WriteString(" in ")
+        p.node(n.Iterable, 0)
+      } else {
+        p.out.WriteString(" = ")
+        p.node(n.StartVal, 0)
+        p.out.WriteString(" in ")
+        p.node(n.EndVal, 0)
+      }
+      if n.StepVal != nil {
+        p.out.WriteString(" -> ")
+        p.node(n.StepVal, 0)
+      }
+      p.out.WriteString(" ")
+      p.block(n.BodyNode, p.canInline(n.BodyNode))
+    case *WhileNode:
+      p.out.WriteString("while ")
+      p.node(n.Cond, 0)
+      p.out.WriteString(" ")
+      p.block(n.BodyNode, p.canInline(n.BodyNode))
+    case *FuncDefNode:
+      p.out.WriteString("fn ")
+      if name, _ := n.VarNameTok.value.(string); name != "" {
+        p.out.WriteString(name)
+      }
+      args := []string{}
+      for idx, tok := range n.ArgNameToks {
+        typeTok := Token{}
+        if idx < len(n.ArgTypeToks) {
+          typeTok = n.ArgTypeToks[idx]
+        }
+        args = append(args, annotation(tok.value.(string), typeTok, ": "))
+      }
+      p.out.WriteString(annotation("("+strings.Join(args, ", ")+")", n.ReturnTypeTok, " -> ") + " ")
+      p.block(n.BodyNode, p.canInline(n.BodyNode))
+    case *ClassDefNode:
+      p.classDef(n)
+    case *ImportNode:
+      p.out.WriteString("import " + quoteString(n.PathTok.value.(string)))
+      if alias, _ := n.AliasTok.value.(string); alias != "" {
+        p.out.WriteString(" as " + alias)
+      }
+    case *FromImportNode:
+      p.out.WriteString("from " + quoteString(n.PathTok.value.(string)) + " import ")
+      p.out.WriteString(strings.Join(tokenValues(n.NameToks), ", "))
+    default:
+      panic(fmt.Sprintf("Format: unexpected node type %T", node))
+  }
+
+  if end := node.GetPosEnd(); end.ln > p.lastLine {
+    p.lastLine = end.ln
+  }
+}
+
+func (p *printer) classDef(n *ClassDefNode) {
+  p.out.WriteString("class " + n.ClassNameTok.value.(string))
+  if n.ParentNode != nil {
+    p.out.WriteString("(")
+    p.node(n.ParentNode, 0)
+    p.out.WriteString(")")
+  }
+
+  type member struct {
+    pos Position
+    print func()
+  }
+  members := []member{}
+  for idx, tok := range n.FieldNameToks {
+    valueNode := n.FieldValueNodes[idx]
+    name := tok.value.(string)
+    members = append(members, member{tok.PosStart, func() {
+      p.out.WriteString(name)
+      if valueNode != nil {
+        p.out.WriteString(" = ")
+        p.node(valueNode, 0)
+      }
+    }})
+  }
+  for _, method := range n.MethodNodes {
+    members = append(members, member{method.PosStart, func() { p.node(method, 0) }})
+  }
+  sort.SliceStable(members, func(a, b int) bool { return members[a].pos.idx < members[b].pos.idx })
+
+  if len(members) == 0 && !p.hasCommentsIn(n.ClassNameTok.PosEnd, n.PosEnd) {
+    p.out.WriteString(" {}")
+    return
+  }
+
+  p.out.WriteString(" {")
+  // A comment after the brace stays there.
+  if p.lastLine < n.ClassNameTok.PosEnd.ln {
+    p.lastLine = n.ClassNameTok.PosEnd.ln
+  }
+  p.trailingComment()
+  p.newline()
+  p.indent += 1
+  first := true
+  for _, m := range members {
+    first = p.flushComments(m.pos, first)
+    p.separate(m.pos.ln, first)
+    p.writeIndent()
+    m.print()
+    if m.pos.ln > p.lastLine {
+      p.lastLine = m.pos.ln
+    }
+    p.trailingComment()
+    p.newline()
+    first = false
+  }
+  p.flushComments(n.PosEnd, first)
+  p.indent -= 1
+  p.writeIndent()
+  p.out.WriteString("}")
+  p.lastLine = n.PosEnd.ln
+}
@@ -0,0 +1,79 @@
+package lang
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatGolden formats the programs in testdata/fmt, which must give
+// their .golden file, comments and all.
+func TestFormatGolden(t *testing.T) {
+  paths, _ := filepath.Glob(filepath.Join("testdata", "fmt", "*.scv"))
+  if len(paths) == 0 {
+    t.Fatal("no programs in testdata/fmt")
+  }
+  for _, path := range paths {
+    text, err := os.ReadFile(path)
+    if err != nil {
+      t.Fatal(err)
+    }
+    golden, err := os.ReadFile(strings.TrimSuffix(path, ".scv") + ".golden")
+    if err != nil {
+      t.Fatal(err)
+    }
+    got, fmtErr := Format(path, string(text))
+    if fmtErr != nil {
+      t.Fatal(fmtErr.AsString())
+    }
+    if got != string(golden) {
+      t.Errorf("%v: got\n%v\nwant\n%v", path, got, string(golden))
+    }
+  }
+}
+
+// TestFormatIdempotent formats every program twice: the second time must
+// change nothing, and neither may change what the program means.
+func TestFormatIdempotent(t *testing.T) {
+  paths, _ := filepath.Glob(filepath.Join("testdata", "*.scv"))
+  golden, _ := filepath.Glob(filepath.Join("testdata", "fmt", "*.golden"))
+  for _, path := range append(paths, golden...) {
+    text, err := os.ReadFile(path)
+    if err != nil {
+      t.Fatal(err)
+    }
+    once, fmtErr := Format(path, string(text))
+    if fmtErr != nil {
+      t.Fatal(fmtErr.AsString())
+    }
+    twice, fmtErr := Format(path, once)
+    if fmtErr != nil {
+      t.Fatal(fmtErr.AsString())
+    }
+    if twice != once {
+      t.Errorf("%v: formatting again gave\n%v\nnot\n%v", path, twice, once)
+    }
+    before, _ := Parse(path, string(text))
+    after, _ := Parse(path, once)
+    if before.String() != after.String() {
+      t.Errorf("%v: formatting changed the tree to\n%v", path, after)
+    }
+  }
+}
+
+func TestFormatKeepsComments(t *testing.T) {
+  text := "# top\nvar x = 1 # trailing\nfn f() {\n  # inside\n  x # last\n}\n# bottom\n"
+  got, err := Format("<test>", text)
+  if err != nil {
+    t.Fatal(err.AsString())
+  }
+  if got != text {
+    t.Errorf("got\n%v", got)
+  }
+  for _, comment := range []string{"# top", "# trailing", "# inside", "# last", "# bottom"} {
+    if !strings.Contains(got, comment) {
+      t.Errorf("lost %v", comment)
+    }
+  }
+}
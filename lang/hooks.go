@@ -0,0 +1,75 @@
+package lang
+
+// Hooks are called as a run is evaluated, for tracing and instrumentation.
+// Any of them may be nil. They are called from the goroutine evaluating the
+// script, tasks included, so hooks of runs that spawn need to be safe for
+// concurrent use. Runs with hooks walk the tree, Options.VM is ignored.
+type Hooks struct {
+  // OnNodeEnter and OnNodeExit are called around the evaluation of each
+  // node, value is nil when it failed. The nodes of a generator that is not
+  // run to its end are never exited.
+  OnNodeEnter func(node Node, context *Context)
+  OnNodeExit  func(node Node, context *Context, value Val)
+  // OnCall and OnReturn are called around calls to functions and built-ins,
+  // tail calls included, with the context the call is made from. node is
+  // the body of a function and nil for a built-in, value is nil when the
+  // call failed or ended in a tail call.
+  OnCall   func(node Node, context *Context, callee Val, args []Val)
+  OnReturn func(node Node, context *Context, callee Val, value Val)
+  // OnError is called once for an error, with the innermost node it was
+  // raised by.
+  OnError func(node Node, context *Context, err *Error)
+  // OnAssign is called after a variable or field is assigned.
+  OnAssign func(node Node, context *Context, name string, value Val)
+}
+
+func (r *runState) hooks() *Hooks {
+  if r == nil {
+    return nil
+  }
+  return r.options.Hooks
+}
+
+func (i *Interpreter) visitHooked(hooks *Hooks, node Node, context Context) RTResult {
+  if hooks.OnNodeEnter != nil {
+    hooks.OnNodeEnter(node, &context)
+  }
+  i.entered = node
+  res := i.Visit(node, context)
+  if res.error != nil && !res.error.reported {
+    res.error.reported = true
+    if hooks.OnError != nil {
+      hooks.OnError(node, &context, res.error)
+    }
+  }
+  if hooks.OnNodeExit != nil {
+    value, _ := res.value.(Val)
+    hooks.OnNodeExit(node, &context, value)
+  }
+  return res
+}
+
+// callHooked runs a call between OnCall and OnReturn. Contexts are taken by
+// value here and in assigned so that only runs with hooks copy them to the
+// heap.
+func callHooked(hooks *Hooks, node Node, context Context, callee Val, args []Val, call func() RTResult) RTResult {
+  if hooks.OnCall != nil {
+    hooks.OnCall(node, &context, callee, args)
+  }
+  res := call()
+  if hooks.OnReturn != nil {
+    result := res.value
+    if res.shouldReturn {
+      result = res.funcReturnValue
+    }
+    value, _ := result.(Val)
+    hooks.OnReturn(node, &context, callee, value)
+  }
+  return res
+}
+
+func (h *Hooks) assigned(node Node, context Context, name string, value Val) {
+  if h.OnAssign != nil {
+    h.OnAssign(node, &context, name, value)
+  }
+}
@@ -0,0 +1,98 @@
+package lang
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// trace runs text with hooks that record the calls, returns, errors and
+// assignments.
+func trace(t *testing.T, text string) (events []string, err *Error) {
+  t.Helper()
+  hooks := &Hooks{
+    OnCall: func(node Node, context *Context, callee Val, args []Val) {
+      events = append(events, fmt.Sprintf("call %v %v", callee, args))
+    },
+    OnReturn: func(node Node, context *Context, callee Val, value Val) {
+      events = append(events, fmt.Sprintf("return %v %v", callee, value))
+    },
+    OnError: func(node Node, context *Context, err *Error) {
+      events = append(events, fmt.Sprintf("error %v at %v", err.Details, node))
+    },
+    OnAssign: func(node Node, context *Context, name string, value Val) {
+      events = append(events, fmt.Sprintf("assign %T %v %v", node, name, value))
+    },
+  }
+  _, err = RunWithOptions("<test>", text, NewGlobals(), Options{Hooks: hooks})
+  return events, err
+}
+
+func filterEvents(events []string, prefixes ...string) []string {
+  filtered := []string{}
+  for _, event := range events {
+    for _, prefix := range prefixes {
+      if strings.HasPrefix(event, prefix) {
+        filtered = append(filtered, event)
+      }
+    }
+  }
+  return filtered
+}
+
+func TestHooksPairCallsThroughTailCalls(t *testing.T) {
+  events, err := trace(t, "fn g(x) { x + 1 }\nfn f(x) { g(x) }\nfn loop(n) { if n == 0 { return f(n) }; loop(n - 1) }\nloop(2)")
+  if err != nil {
+    t.Fatal(err.AsString())
+  }
+  // A call that ends in a tail call returns nothing before the next one
+  // starts, so every call is paired with its return.
+  want := []string{
+    "call <function loop> [2]",
+    "return <function loop> <nil>",
+    "call <function loop> [1]",
+    "return <function loop> <nil>",
+    "call <function loop> [0]",
+    "return <function loop> <nil>",
+    "call <function f> [0]",
+    "return <function f> <nil>",
+    "call <function g> [0]",
+    "return <function g> 1",
+  }
+  got := filterEvents(events, "call", "return")
+  if strings.Join(got, "\n") != strings.Join(want, "\n") {
+    t.Errorf("got\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+  }
+}
+
+func TestHooksReportAnErrorOnce(t *testing.T) {
+  events, err := trace(t, "fn inner(x) { x / 0 }\nfn outer(x) { inner(x) + 1 }\nvar y = outer(2) * 3")
+  if err == nil {
+    t.Fatal("expected an error")
+  }
+  got := filterEvents(events, "error")
+  if len(got) != 1 || !strings.Contains(got[0], "Division by zero") || !strings.HasSuffix(got[0], "(binop / (var-access x) (number 0))") {
+    t.Errorf("got %v", got)
+  }
+  // The calls the error went through still return.
+  if returns := filterEvents(events, "return"); len(returns) != 2 {
+    t.Errorf("got %v", returns)
+  }
+}
+
+func TestHooksSeeFieldAssignments(t *testing.T) {
+  events, err := trace(t, "class Point { x = 0 }\nvar p = Point()\np.x = 5\nvar n = 1\nn = 2")
+  if err != nil {
+    t.Fatal(err.AsString())
+  }
+  want := []string{
+    "assign *lang.VarAssignNode p Point(x=0)",
+    "assign *lang.FieldAssignNode x 5",
+    "assign *lang.VarAssignNode n 1",
+    "assign *lang.VarAssignNode n 2",
+  }
+  got := filterEvents(events, "assign")
+  if strings.Join(got, "\n") != strings.Join(want, "\n") {
+    t.Errorf("got\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+  }
+}
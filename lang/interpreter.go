@@ -1,19 +1,29 @@
 package lang
 
-import (
-	"fmt"
-	"reflect"
-)
+import "fmt"
 
 type RTResult struct {
   value any
   error *Error
+  funcReturnValue any
+  shouldReturn bool
+  tailCall *TailCall
+}
+
+// TailCall is a call in tail position that the calling function runs in
+// place of its own frame.
+type TailCall struct {
+  Function *Function
+  Args []Val
 }
 
 func (rtr *RTResult) Register(res RTResult) any {
   if res.error != nil {
     rtr.error = res.error
   }
+  rtr.funcReturnValue = res.funcReturnValue
+  rtr.shouldReturn = res.shouldReturn
+  rtr.tailCall = res.tailCall
   return res.value
 }
 
@@ -22,6 +32,22 @@ func (rtr *RTResult) Success(value any) RTResult{
   return *rtr
 }
 
+func (rtr *RTResult) SuccessReturn(value any) RTResult{
+  rtr.funcReturnValue = value
+  rtr.shouldReturn = true
+  return *rtr
+}
+
+func (rtr *RTResult) SuccessTailCall(call *TailCall) RTResult{
+  rtr.tailCall = call
+  rtr.shouldReturn = true
+  return *rtr
+}
+
+func (rtr *RTResult) ShouldReturn() bool {
+  return rtr.error != nil || rtr.shouldReturn
+}
+
 func (rtr *RTResult) Failure(error Error) RTResult{
   rtr.error = &error
   return *rtr
@@ -29,50 +55,108 @@ func (rtr *RTResult) Failure(error Error) RTResult{
 
 type Interpreter struct {
   node Node
+  // Set when running compiled code, functions then get their chunk.
+  program *Program
+  // The node visitHooked has called the hooks for, Visit then evaluates it
+  // without calling them again.
+  entered Node
 }
 
 func (i *Interpreter) Visit(node Node, context Context) RTResult {
-	nodeType := reflect.TypeOf(node)
-	if nodeType.Kind() == reflect.Ptr {
-		nodeType = nodeType.Elem()
-	}
-	MethodName := fmt.Sprintf("Visit%v", nodeType.Name())
-	method := reflect.ValueOf(i).MethodByName(MethodName)
-	if !method.IsValid() {
-		panic("No " + MethodName + " method defined")
-	}
-
-	results := method.Call([]reflect.Value{reflect.ValueOf(node), reflect.ValueOf(context)})
-	if len(results) == 0 {
-		panic("Visit method did not return anything")
-	}
+  if hooks := context.run.hooks(); hooks != nil {
+    if i.entered != node {
+      return i.visitHooked(hooks, node, context)
+    }
+    i.entered = nil
+  }
+  res := i.visit(node, context)
+  // Values are charged for as they come out of the node that made them,
+  // whether a literal, an operator or a call.
+  if value, ok := res.value.(Val); ok {
+    if err := context.run.charge(value, node.GetPosStart(), node.GetPosEnd(), context); err != nil {
+      return res.Failure(*err)
+    }
+  }
+  return res
+}
 
-	rtResult, ok := results[0].Interface().(RTResult)
-	if !ok {
-		panic(fmt.Sprintf("Visit method returned unexpected type: %T", results[0].Interface()))
-	}
+func (i *Interpreter) visit(node Node, context Context) RTResult {
+  switch n := node.(type) {
+    case *StringNode:
+      return i.VisitStringNode(n, context)
+    case *NumberNode:
+      return i.VisitNumberNode(n, context)
+    case *VarAccessNode:
+      return i.VisitVarAccessNode(n, context)
+    case *VarAssignNode:
+      return i.VisitVarAssignNode(n, context)
+    case *IfNode:
+      return i.VisitIfNode(n, context)
+    case *ForNode:
+      return i.VisitForNode(n, context)
+    case *WhileNode:
+      return i.VisitWhileNode(n, context)
+    case *FuncDefNode:
+      return i.VisitFuncDefNode(n, context)
+    case *CallNode:
+      return i.VisitCallNode(n, context)
+    case *StatementsNode:
+      return i.VisitStatementsNode(n, context)
+    case *ReturnNode:
+      return i.VisitReturnNode(n, context)
+    case *YieldNode:
+      return i.VisitYieldNode(n, context)
+    case *SpawnNode:
+      return i.VisitSpawnNode(n, context)
+    case *AwaitNode:
+      return i.VisitAwaitNode(n, context)
+    case *FieldAccessNode:
+      return i.VisitFieldAccessNode(n, context)
+    case *FieldAssignNode:
+      return i.VisitFieldAssignNode(n, context)
+    case *ClassDefNode:
+      return i.VisitClassDefNode(n, context)
+    case *SuperNode:
+      return i.VisitSuperNode(n, context)
+    case *BinOpNode:
+      return i.VisitBinOpNode(n, context)
+    case *UnaryOpNode:
+      return i.VisitUnaryOpNode(n, context)
+    case *ImportNode:
+      return i.VisitImportNode(n, context)
+    case *FromImportNode:
+      return i.VisitFromImportNode(n, context)
+  }
 
-	return rtResult
+  res := RTResult{}
+  return res.Failure(*RTError(
+    node.GetPosStart(), node.GetPosEnd(),
+    fmt.Sprintf("Cannot evaluate %T", node),
+    context,
+  ))
 }
 
 func (i *Interpreter) VisitStringNode(node *StringNode, context Context) RTResult {
   res := RTResult{}
-  return res.Success(
-    NewString(node.Tok.value.(string)).SetContext(&context).SetPos(&node.PosStart, &node.PosEnd),
-  )
+  value := NewString(node.Tok.value.(string)).SetContext(&context).SetPos(&node.PosStart, &node.PosEnd)
+  return res.Success(value)
 }
 
 func (i *Interpreter) VisitNumberNode(node *NumberNode, context Context) RTResult {
   res := RTResult{}
-  return res.Success(
-    NewNumber(node.Tok.value).SetContext(&context).SetPos(&node.PosStart, &node.PosEnd),
-  )
+  value := NewNumber(node.Tok.value).SetContext(&context).SetPos(&node.PosStart, &node.PosEnd)
+  return res.Success(value)
 }
 
 func (i *Interpreter) VisitVarAccessNode(node *VarAccessNode, context Context) RTResult {
   res := RTResult{}
   var_name := node.VarName.value
-  value := context.SymbolTable.Get(var_name.(string))
+  var value Val
+  if node.Binding.Resolved {
+    value = context.SymbolTable.GetSlot(node.Binding.Depth, node.Binding.Slot, var_name.(string))
+  } else {
+    value = context.SymbolTable.Get(var_name.(string))
+  }
   if value == nil {
     return res.Failure(*RTError(
       node.PosStart, node.PosEnd,
@@ -93,12 +177,85 @@ func (i *Interpreter) VisitVarAccessNode(node *VarAccessNode, context Context) R
   return res.Success(value)
 }
 
+func (i *Interpreter) declare(nameTok Token, value Val, isConst bool, context Context) *Error {
+  return i.declareAt(nameTok, Binding{}, value, isConst, context)
+}
+
+// declareAt is declare for names that Resolve has already bound to a slot of
+// the current frame.
+func (i *Interpreter) declareAt(nameTok Token, binding Binding, value Val, isConst bool, context Context) *Error {
+  name := nameTok.value.(string)
+  table := context.SymbolTable.Ancestor(binding.Depth)
+  slot := binding.Slot
+  if !binding.Resolved {
+    for table.Iteration {
+      table = table.Parent
+    }
+    slot = table.slot(name)
+  }
+  var old Val
+  if symbol := table.LookupSlot(slot, name); symbol != nil {
+    if symbol.Const {
+      return ConstAssignError(nameTok.PosStart, nameTok.PosEnd, name, symbol.DeclPos, context)
+    }
+    old = symbol.Value
+  }
+  if err := context.run.store(nil, old, value, nameTok.PosStart, nameTok.PosEnd, context); err != nil {
+    return err
+  }
+  if isConst {
+    declPos := nameTok.PosStart.Copy()
+    table.SetConst(name, value, &declPos)
+  } else {
+    table.SetSlot(slot, name, value)
+  }
+  return nil
+}
+
+// assign updates the nearest variable called name, starting from the frame
+// the binding points at, for assignments without var.
+func (i *Interpreter) assign(nameTok Token, binding Binding, value Val, context Context) *Error {
+  name := nameTok.value.(string)
+  table := context.SymbolTable.Ancestor(binding.Depth)
+  slot := binding.Slot
+  if !binding.Resolved {
+    slot = -1
+  }
+  symbol := table.LookupSlot(slot, name)
+  for symbol == nil && table.Parent != nil {
+    table = table.Parent
+    slot = table.slot(name)
+    symbol = table.Lookup(name)
+  }
+  if symbol == nil {
+    return RTError(nameTok.PosStart, nameTok.PosEnd, fmt.Sprintf("'%v' is not defined", name), context)
+  }
+  if symbol.Const {
+    return ConstAssignError(nameTok.PosStart, nameTok.PosEnd, name, symbol.DeclPos, context)
+  }
+  if err := context.run.store(nil, symbol.Value, value, nameTok.PosStart, nameTok.PosEnd, context); err != nil {
+    return err
+  }
+  table.SetSlot(slot, name, value)
+  return nil
+}
+
 func (i *Interpreter) VisitVarAssignNode(node *VarAssignNode, context Context) RTResult {
   res := RTResult{}
-  var_name := node.VarName.value
   value := res.Register(i.Visit(node.ValueNode, context))
-  if res.error != nil { return res }
-  context.SymbolTable.Set(var_name.(string), value.(Val))
+  if res.ShouldReturn() { return res }
+  var err *Error
+  if node.IsUpdate {
+    err = i.assign(node.VarName, node.Binding, value.(Val), context)
+  } else {
+    err = i.declareAt(node.VarName, node.Binding, value.(Val), node.IsConst, context)
+  }
+  if err != nil {
+    return res.Failure(*err)
+  }
+  if hooks := context.run.hooks(); hooks != nil {
+    hooks.assigned(node, context, node.VarName.value.(string), value.(Val))
+  }
   return res.Success(nil)
 }
 
@@ -110,20 +267,20 @@ func (i *Interpreter) VisitIfNode(node *IfNode, context Context) RTResult {
     expr := Case[1]
 
     cond_val := res.Register(i.Visit(condition, context))
-    if res.error != nil { return res }
+    if res.ShouldReturn() { return res }
     
     switch v := cond_val.(type) {
       case Val:
         if v.IsTrue() {
           expr_val := res.Register(i.Visit(expr, context))
-          if res.error != nil { return res }
+          if res.ShouldReturn() { return res }
           return res.Success(expr_val)
         }
     }
   }
   if node.ElseCase != nil {
     else_val := res.Register(i.Visit(node.ElseCase, context))
-    if res.error != nil { return res }
+    if res.ShouldReturn() { return res }
     return res.Success(else_val)
   }
   return res.Success(nil)
@@ -131,19 +288,22 @@ func (i *Interpreter) VisitIfNode(node *IfNode, context Context) RTResult {
 
 func (i *Interpreter) VisitForNode(node *ForNode, context Context) RTResult {
   res := RTResult{}
+  if node.Iterable != nil {
+    return i.visitForIn(node, context)
+  }
 
   startVal := res.Register(i.Visit(node.StartVal, context))
-  if res.error != nil { return res }
+  if res.ShouldReturn() { return res }
   startNum := startVal.(*Number)
 
   endVal := res.Register(i.Visit(node.EndVal, context))
-  if res.error != nil { return res }
+  if res.ShouldReturn() { return res }
   endNum := endVal.(*Number)
   
   var stepNum *Number
   if node.StepVal != nil {
     stepVal := res.Register(i.Visit(node.StepVal, context))
-    if res.error != nil { return res }
+    if res.ShouldReturn() { return res }
     stepNum = stepVal.(*Number)
   } else {
     stepNum = NewNumber(1).(*Number)
@@ -160,32 +320,90 @@ func (i *Interpreter) VisitForNode(node *ForNode, context Context) RTResult {
     condition = func() bool { return IVal >= EndVal }
   }
   for condition() {
-    context.SymbolTable.Set(node.VarNameTok.value.(string), NewNumber(IVal))
+    if err := context.run.step(node.PosStart, node.PosEnd, context); err != nil {
+      return res.Failure(*err)
+    }
+    value := NewNumber(IVal)
     IVal += StepVal
 
-    res.Register(i.Visit(node.BodyNode, context))
-    if res.error != nil { return res }
+    res.Register(i.iterate(node, value, context))
+    if res.ShouldReturn() { return res }
+  }
+  return res.Success(nil)
+}
+
+func (i *Interpreter) visitForIn(node *ForNode, context Context) RTResult {
+  res := RTResult{}
+  value := res.Register(i.Visit(node.Iterable, context))
+  if res.ShouldReturn() { return res }
+  values, err := iterator(node, value, context)
+  if err != nil { return res.Failure(*err) }
+
+  for {
+    value, ok, err := values.Next(node.PosStart, node.PosEnd, context)
+    if err != nil { return res.Failure(*err) }
+    if !ok { break }
+    if err := context.run.step(node.PosStart, node.PosEnd, context); err != nil {
+      return res.Failure(*err)
+    }
+    res.Register(i.iterate(node, value, context))
+    if res.ShouldReturn() { return res }
   }
   return res.Success(nil)
 }
 
+// iterate runs the body of a for loop once, with the loop variable set to
+// value.
+func (i *Interpreter) iterate(node *ForNode, value Val, context Context) RTResult {
+  res := RTResult{}
+  if err := i.declareAt(node.VarNameTok, node.Binding, value, false, context); err != nil {
+    return res.Failure(*err)
+  }
+  if node.Layout != nil {
+    context.SymbolTable = NewIterationFrame(context.SymbolTable, node.Layout)
+    context.SymbolTable.SetSlot(0, node.VarNameTok.value.(string), value)
+  }
+  return i.Visit(node.BodyNode, context)
+}
+
+// iterator returns what a for-in loop over value runs over.
+func iterator(node *ForNode, value any, context Context) (Iterator, *Error) {
+  switch v := value.(type) {
+    case *GeneratorVal:
+      return v, nil
+    case *ListVal:
+      return v.iterator(), nil
+    case *MapVal:
+      return v.iterator(context), nil
+  }
+  return nil, RTError(
+    node.Iterable.GetPosStart(), node.Iterable.GetPosEnd(),
+    fmt.Sprintf("Cannot iterate over %v", describe(value)),
+    context,
+  )
+}
+
 func (i *Interpreter) VisitWhileNode(node *WhileNode, context Context) RTResult {
   res := RTResult{}
 
   for true{
-    condition := res.Register(i.Visit(node.Cond, context)).(*Number)
-    if res.error != nil { return res }
-
-    if !condition.IsTrue() { break }
+    condition := res.Register(i.Visit(node.Cond, context))
+    if res.ShouldReturn() { return res }
+
+    // A statement such as an assignment has no value, which is false as
+    // it is for if and the VM.
+    if cond, ok := condition.(Val); !ok || !cond.IsTrue() { break }
+    if err := context.run.step(node.PosStart, node.PosEnd, context); err != nil {
+      return res.Failure(*err)
+    }
 
     res.Register(i.Visit(node.BodyNode, context))
-    if res.error != nil { return res }
+    if res.ShouldReturn() { return res }
   }
   return res.Success(nil)
 }
 
-func (i *Interpreter) VisitFuncDefNode(node *FuncDefNode, context Context) RTResult {
-  res := RTResult{}
+func (i *Interpreter) makeFunction(node *FuncDefNode, context Context) *Function {
   funcName := node.VarNameTok.value
   
   body := node.BodyNode
@@ -194,42 +412,297 @@ func (i *Interpreter) VisitFuncDefNode(node *FuncDefNode, context Context) RTRes
     arg_names = append(arg_names, v.value.(string))
   }
 
-  funcValue := NewFunction(funcName.(string), body, arg_names).SetContext(&context).SetPos(&node.PosStart, &node.PosEnd)
+  function := NewFunction(funcName.(string), body, arg_names)
+  function.Layout = node.Layout
+  function.Generator = node.Generator
+  if i.program != nil {
+    function.Code = i.program.Functions[node]
+  }
+  // The frames the function may use are not given back when their calls
+  // return.
+  if context.run != nil && context.run.accounting {
+    context.SymbolTable.capture()
+  }
+  return function.SetContext(&context).SetPos(&node.PosStart, &node.PosEnd).(*Function)
+}
+
+func (i *Interpreter) VisitFuncDefNode(node *FuncDefNode, context Context) RTResult {
+  res := RTResult{}
+  funcValue := i.makeFunction(node, context)
   
   emptyTok := Token{value: ""}
   if node.VarNameTok != emptyTok {
-    context.SymbolTable.Set(funcName.(string), funcValue)
+    if err := i.declare(node.VarNameTok, funcValue, false, context); err != nil {
+      return res.Failure(*err)
+    }
   }
 
   return res.Success(funcValue)
 }
 
+func callable(node *CallNode, value any, context Context) (Callable, *Error) {
+  CallVal, ok := value.(Callable)
+  if !ok {
+    return nil, RTError(
+      node.PosStart, node.PosEnd,
+      fmt.Sprintf("%v is not callable", describe(value)),
+      context,
+    )
+  }
+  CallVal.SetPos(&node.PosStart, &node.PosEnd)
+  return CallVal, nil
+}
+
+// tailCall returns the call to hand back to the running function, or nil when
+// callee is not SceneV code and has to be called directly.
+func tailCall(callee Callable, args []Val) *TailCall {
+  switch c := callee.(type) {
+    case *Function:
+      return &TailCall{c, args}
+    case *BoundMethod:
+      method := c.Method.Copy().SetPos(c.PosStart, c.PosEnd).(*Function)
+      return &TailCall{method, append([]Val{c.Instance}, args...)}
+  }
+  return nil
+}
+
 func (i *Interpreter) VisitCallNode(node *CallNode, context Context) RTResult {
   res := RTResult{}
   args := []Val{}
 
   valueToCall := res.Register(i.Visit(node.NodeToCall, context))
-  if res.error != nil { return res }
-  var CallVal *Function
-  if fn, ok := valueToCall.(*Function); ok {
-    CallVal = fn.SetPos(&node.PosStart, &node.PosEnd).(*Function)
-  }
+  if res.ShouldReturn() { return res }
+  CallVal, err := callable(node, valueToCall, context)
+  if err != nil { return res.Failure(*err) }
 
   for _, argNode := range node.ArgNodes {
-    args = append(args, res.Register(i.Visit(argNode, context)).(Val))
-    if res.error != nil { return res }
+    arg := res.Register(i.Visit(argNode, context))
+    if res.ShouldReturn() { return res }
+    args = append(args, arg.(Val))
+  }
+  if node.Tail {
+    if call := tailCall(CallVal, args); call != nil {
+      return res.SuccessTailCall(call)
+    }
   }
-  returnVal := res.Register(CallVal.Execute(args))
-  if res.error != nil { return res }
+  returnVal := res.Register(CallVal.Execute(args, &context))
+  if res.ShouldReturn() { return res }
   return res.Success(returnVal)
 }
 
+// VisitSpawnNode evaluates the callee and arguments in the spawning task,
+// only the call itself runs concurrently.
+func (i *Interpreter) VisitSpawnNode(node *SpawnNode, context Context) RTResult {
+  res := RTResult{}
+  args := []Val{}
+
+  valueToCall := res.Register(i.Visit(node.Call.NodeToCall, context))
+  if res.ShouldReturn() { return res }
+  CallVal, err := callable(node.Call, valueToCall, context)
+  if err != nil { return res.Failure(*err) }
+
+  for _, argNode := range node.Call.ArgNodes {
+    arg := res.Register(i.Visit(argNode, context))
+    if res.ShouldReturn() { return res }
+    args = append(args, arg.(Val))
+  }
+  return res.Success(Spawn(CallVal, args, context).SetContext(&context).SetPos(&node.PosStart, &node.PosEnd))
+}
+
+func (i *Interpreter) VisitYieldNode(node *YieldNode, context Context) RTResult {
+  res := RTResult{}
+  value := res.Register(i.Visit(node.Node, context))
+  if res.ShouldReturn() { return res }
+  return yield(node, value, context)
+}
+
+func yield(node *YieldNode, value any, context Context) RTResult {
+  res := RTResult{}
+  if context.coroutine == nil {
+    return res.Failure(*RTError(node.PosStart, node.PosEnd, "'yield' outside of a function", context))
+  }
+  if err := context.coroutine.yield(value.(Val), node.PosStart, node.PosEnd, context); err != nil {
+    return res.Failure(*err)
+  }
+  return res.Success(nil)
+}
+
+func (i *Interpreter) VisitAwaitNode(node *AwaitNode, context Context) RTResult {
+  res := RTResult{}
+  value := res.Register(i.Visit(node.Node, context))
+  if res.ShouldReturn() { return res }
+  return await(node, value, context)
+}
+
+func await(node *AwaitNode, value any, context Context) RTResult {
+  res := RTResult{}
+  task, ok := value.(*Task)
+  if !ok {
+    return res.Failure(*RTError(node.PosStart, node.PosEnd, fmt.Sprintf("Cannot await %v", describe(value)), context))
+  }
+  return task.Await(node.PosStart, node.PosEnd, context)
+}
+
+func (i *Interpreter) VisitStatementsNode(node *StatementsNode, context Context) RTResult {
+  res := RTResult{}
+  if len(node.Statements) == 0 {
+    return res.Success(null(context))
+  }
+  var value any
+
+  for _, statement := range node.Statements {
+    value = res.Register(i.Visit(statement, context))
+    if res.ShouldReturn() { return res }
+  }
+  return res.Success(value)
+}
+
+func (i *Interpreter) VisitReturnNode(node *ReturnNode, context Context) RTResult {
+  res := RTResult{}
+  if node.NodeToReturn == nil {
+    return res.SuccessReturn(null(context))
+  }
+  value := res.Register(i.Visit(node.NodeToReturn, context))
+  if res.ShouldReturn() { return res }
+  return res.SuccessReturn(value)
+}
+
+func (i *Interpreter) VisitFieldAccessNode(node *FieldAccessNode, context Context) RTResult {
+  res := RTResult{}
+  object := res.Register(i.Visit(node.NodeToAccess, context))
+  if res.ShouldReturn() { return res }
+  return getField(node, object, context)
+}
+
+func getField(node *FieldAccessNode, object any, context Context) RTResult {
+  res := RTResult{}
+  fieldName := node.FieldNameTok.value.(string)
+
+  if goObject, ok := object.(*GoObject); ok {
+    value, err := goObject.Lookup(fieldName)
+    if err != nil {
+      return res.Failure(*RTError(node.FieldNameTok.PosStart, node.FieldNameTok.PosEnd, err.Error(), context))
+    }
+    return res.Success(value.SetContext(&context).SetPos(&node.PosStart, &node.PosEnd))
+  }
+  fields, ok := object.(HasFields)
+  if !ok {
+    return res.Failure(*RTError(
+      node.PosStart, node.PosEnd,
+      fmt.Sprintf("%v has no field '%v'", describe(object), fieldName),
+      context,
+    ))
+  }
+  value := fields.GetField(fieldName)
+  if value == nil {
+    return res.Failure(*RTError(
+      node.FieldNameTok.PosStart, node.FieldNameTok.PosEnd,
+      fmt.Sprintf("%v has no field '%v'", describe(object), fieldName),
+      context,
+    ))
+  }
+  return res.Success(value.Copy().SetPos(&node.PosStart, &node.PosEnd))
+}
+
+func (i *Interpreter) VisitFieldAssignNode(node *FieldAssignNode, context Context) RTResult {
+  res := RTResult{}
+  object := res.Register(i.Visit(node.NodeToAccess, context))
+  if res.ShouldReturn() { return res }
+
+  value := res.Register(i.Visit(node.ValueNode, context))
+  if res.ShouldReturn() { return res }
+  res = setField(node, object, value, context)
+  if hooks := context.run.hooks(); hooks != nil && res.error == nil {
+    hooks.assigned(node, context, node.FieldNameTok.value.(string), value.(Val))
+  }
+  return res
+}
+
+func setField(node *FieldAssignNode, object any, value any, context Context) RTResult {
+  res := RTResult{}
+  fieldName := node.FieldNameTok.value.(string)
+
+  if goObject, ok := object.(*GoObject); ok {
+    if err := goObject.Assign(fieldName, value.(Val)); err != nil {
+      return res.Failure(*RTError(node.FieldNameTok.PosStart, node.FieldNameTok.PosEnd, err.Error(), context))
+    }
+    return res.Success(nil)
+  }
+  if instance, ok := object.(*Instance); ok {
+    if symbol := instance.Fields.Lookup(fieldName); symbol != nil {
+      if err := context.run.store(instance, symbol.Value, value.(Val), node.PosStart, node.PosEnd, context); err != nil {
+        return res.Failure(*err)
+      }
+    }
+  }
+  fields, ok := object.(HasFields)
+  if !ok || !fields.SetField(fieldName, value.(Val)) {
+    return res.Failure(*RTError(
+      node.FieldNameTok.PosStart, node.FieldNameTok.PosEnd,
+      fmt.Sprintf("%v has no field '%v'", describe(object), fieldName),
+      context,
+    ))
+  }
+  return res.Success(nil)
+}
+
+func (i *Interpreter) VisitClassDefNode(node *ClassDefNode, context Context) RTResult {
+  res := RTResult{}
+  className := node.ClassNameTok.value.(string)
+
+  var parent *Class
+  if node.ParentNode != nil {
+    parentVal := res.Register(i.Visit(node.ParentNode, context))
+    if res.ShouldReturn() { return res }
+    var ok bool
+    parent, ok = parentVal.(*Class)
+    if !ok {
+      return res.Failure(*RTError(
+        node.ParentNode.GetPosStart(), node.ParentNode.GetPosEnd(),
+        fmt.Sprintf("%v is not a class", describe(parentVal)),
+        context,
+      ))
+    }
+  }
+
+  var field_names []string
+  for _, tok := range node.FieldNameToks {
+    field_names = append(field_names, tok.value.(string))
+  }
+
+  class := NewClass(className, parent, field_names, node.FieldValueNodes)
+  class.SetContext(&context).SetPos(&node.PosStart, &node.PosEnd)
+  for _, methodNode := range node.MethodNodes {
+    method := i.makeFunction(methodNode, context)
+    method.Class = class
+    class.Methods[method.Name] = method
+  }
+
+  if err := i.declare(node.ClassNameTok, class, false, context); err != nil {
+    return res.Failure(*err)
+  }
+  return res.Success(class)
+}
+
+func (i *Interpreter) VisitSuperNode(node *SuperNode, context Context) RTResult {
+  res := RTResult{}
+  value := context.SymbolTable.Get("super")
+  if value == nil {
+    return res.Failure(*RTError(
+      node.PosStart, node.PosEnd,
+      "'super' used outside of a method",
+      context,
+    ))
+  }
+  return res.Success(value.Copy().SetPos(&node.PosStart, &node.PosEnd))
+}
+
 func (i *Interpreter) VisitBinOpNode(node *BinOpNode, context Context) RTResult{
   res := RTResult{}
   left := res.Register(i.Visit(node.LeftNode, context))
-  if res.error != nil {return res}
+  if res.ShouldReturn() {return res}
   right := res.Register(i.Visit(node.RightNode, context))
-  if res.error != nil {return res}
+  if res.ShouldReturn() {return res}
 
 	leftNum, ok1 := left.(Val)
 	rightNum, ok2 := right.(Val)
@@ -238,65 +711,116 @@ func (i *Interpreter) VisitBinOpNode(node *BinOpNode, context Context) RTResult{
 		panic("Operands must be values")
 	}
 
-  var result Val
-  var err *Error
+  result, err := binaryOp(leftNum, node.OpTok, rightNum)
+  if err != nil {
+    return res.Failure(*err)
+  }
+  return res.Success(result.SetPos(&node.PosStart, &node.PosEnd))
+}
 
-  if node.OpTok.type_ == PLUS {
-    result, err = leftNum.Add(rightNum)
-  } else if node.OpTok.type_ == MINUS {
-    result, err = leftNum.Sub(rightNum)
-  } else if node.OpTok.type_ == MUL {
-    result, err = leftNum.Mul(rightNum)
-  } else if node.OpTok.type_ == DIV {
-    result, err = leftNum.Div(rightNum)
-  } else if node.OpTok.type_ == POW {
-    result, err = leftNum.Pow(rightNum)
-  } else if node.OpTok.type_ == EE {
-    result, err = leftNum.CompEQ(rightNum)
-  } else if node.OpTok.type_ == NE {
-    result, err = leftNum.CompNE(rightNum)
-  } else if node.OpTok.type_ == LT {
-    result, err = leftNum.CompLT(rightNum)
-  } else if node.OpTok.type_ == GT {
-    result, err = leftNum.CompGT(rightNum)
-  } else if node.OpTok.type_ == LTE {
-    result, err = leftNum.CompLTE(rightNum)
-  } else if node.OpTok.type_ == GTE {
-    result, err = leftNum.CompGTE(rightNum)
-  } else if  node.OpTok.Matches(KEYWORD, "and") {
-    result, err = leftNum.And(rightNum)
-  } else if  node.OpTok.Matches(KEYWORD, "or") {
-    result, err = leftNum.Or(rightNum)
+func binaryOp(left Val, op Token, right Val) (Val, *Error) {
+  if op.type_ == PLUS {
+    return left.Add(right)
+  } else if op.type_ == MINUS {
+    return left.Sub(right)
+  } else if op.type_ == MUL {
+    return left.Mul(right)
+  } else if op.type_ == DIV {
+    return left.Div(right)
+  } else if op.type_ == POW {
+    return left.Pow(right)
+  } else if op.type_ == EE {
+    return left.CompEQ(right)
+  } else if op.type_ == NE {
+    return left.CompNE(right)
+  } else if op.type_ == LT {
+    return left.CompLT(right)
+  } else if op.type_ == GT {
+    return left.CompGT(right)
+  } else if op.type_ == LTE {
+    return left.CompLTE(right)
+  } else if op.type_ == GTE {
+    return left.CompGTE(right)
+  } else if  op.Matches(KEYWORD, "and") {
+    return left.And(right)
+  } else if  op.Matches(KEYWORD, "or") {
+    return left.Or(right)
   }
 
-  if err != nil {
-    return res.Failure(*err)
-  } else {
-    return res.Success(result.SetPos(&node.PosStart, &node.PosEnd))
+  return nil, nil
+}
+
+func unaryOp(op Token, operand Val) (Val, *Error) {
+  if op.type_ == MINUS {
+    return operand.Mul(NewNumber(-1))
+  } else if op.Matches(KEYWORD, "not") {
+    return operand.Not()
   }
+  return operand, nil
 }
 
 func (i *Interpreter) VisitUnaryOpNode(node *UnaryOpNode, context Context) RTResult {
   res := RTResult{}
   number := res.Register(i.Visit(node.Node, context))
-  if res.error != nil {return res}
+  if res.ShouldReturn() {return res}
   num, ok := number.(Val)
   if !ok {
     panic("Operand must be a number")
   }
 
-  var err *Error = nil
+  num, err := unaryOp(node.OpTok, num)
 
-  if node.OpTok.type_ == MINUS {
-    num, err = num.Mul(NewNumber(-1))
-  } else if node.OpTok.Matches(KEYWORD, "not") {
-    num, err = num.Not()
+  if err != nil {
+    return res.Failure(*err)
   }
+  return res.Success(num.SetPos(&node.PosStart, &node.PosEnd))
+}
 
-  if err != nil {
+
+func (i *Interpreter) VisitImportNode(node *ImportNode, context Context) RTResult {
+  res := RTResult{}
+  path := node.PathTok.value.(string)
+
+  module, err := context.run.importModule(path, node.PathTok.PosStart, node.PathTok.PosEnd, context)
+  if err != nil { return res.Failure(*err) }
+
+  aliasTok := node.AliasTok
+  if aliasTok.value.(string) == "" {
+    if !isIdentifier(module.Name) {
+      return res.Failure(*RTError(
+        node.PathTok.PosStart, node.PathTok.PosEnd,
+        fmt.Sprintf("'%v' is not a valid module name, use 'as' to name it", module.Name),
+        context,
+      ))
+    }
+    aliasTok = NewToken(IDENTIFIER, module.Name, &node.PathTok.PosStart, &node.PathTok.PosEnd)
+  }
+  if err := i.declare(aliasTok, module, false, context); err != nil {
     return res.Failure(*err)
-  } else {
-    return res.Success(num.SetPos(&node.PosStart, &node.PosEnd))
   }
+  return res.Success(nil)
 }
 
+func (i *Interpreter) VisitFromImportNode(node *FromImportNode, context Context) RTResult {
+  res := RTResult{}
+  path := node.PathTok.value.(string)
+
+  module, err := context.run.importModule(path, node.PathTok.PosStart, node.PathTok.PosEnd, context)
+  if err != nil { return res.Failure(*err) }
+
+  for _, nameTok := range node.NameToks {
+    name := nameTok.value.(string)
+    value := module.GetField(name)
+    if value == nil {
+      return res.Failure(*RTError(
+        nameTok.PosStart, nameTok.PosEnd,
+        fmt.Sprintf("module '%v' has no name '%v'", module.Name, name),
+        context,
+      ))
+    }
+    if err := i.declare(nameTok, value, false, context); err != nil {
+      return res.Failure(*err)
+    }
+  }
+  return res.Success(nil)
+}
@@ -0,0 +1,129 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+)
+
+// eval runs text with options and gives the string of its value, or of the
+// error it failed with.
+func eval(t *testing.T, text string, options Options) string {
+  t.Helper()
+  result, err := RunWithOptions("<test>", text, NewGlobals(), options)
+  if err != nil {
+    return err.ErrorName + ": " + err.Details
+  }
+  if result == nil {
+    return "<nil>"
+  }
+  return result.(Val).String()
+}
+
+// evalBoth runs text on the tree walker and on the VM and checks that they
+// agree.
+func evalBoth(t *testing.T, text string) string {
+  t.Helper()
+  walked := eval(t, text, Options{})
+  compiled := eval(t, text, Options{VM: true})
+  if walked != compiled {
+    t.Errorf("%q: interpreter gave %v, VM gave %v", text, walked, compiled)
+  }
+  return walked
+}
+
+func TestNullResults(t *testing.T) {
+  tests := []struct {
+    text string
+    want string
+  }{
+    {"fn f() { return }; f()", "0"},
+    {"fn f() {}; f()", "0"},
+    {"fn f() { var x = 1 }; f()", "0"},
+    {"fn f() { return }; var x = f(); x", "0"},
+    {"fn f() {}; fn g(x) { return x }; g(f())", "0"},
+    {"var y = if 1 { } else { 2 }; y", "0"},
+    {"fn f(x) { if x { return } ; return 2 }; f(1) + f(0)", "2"},
+  }
+  for _, test := range tests {
+    if got := evalBoth(t, test.text); got != test.want {
+      t.Errorf("%q = %v, want %v", test.text, got, test.want)
+    }
+  }
+}
+
+func TestClosures(t *testing.T) {
+  tests := []struct {
+    text string
+    want string
+  }{
+    // A counter keeps its count between calls, and each counter its own.
+    {"fn counter() { var n = 0; fn inc() { n = n + 1; n } }\nvar c = counter()\nc(); c(); c()", "3"},
+    {"fn counter() { var n = 0; fn inc() { n = n + 1; n } }\nvar a = counter()\nvar b = counter()\na(); a(); b()", "1"},
+    // The function that made a closure sees what the closure assigned.
+    {"fn f() { var n = 1; fn set() { n = 5 }; set(); n }\nf()", "5"},
+    // Top-level variables are updated the same way.
+    {"var total = 0\nfn add(x) { total = total + x }\nadd(2); add(3); total", "5"},
+    // Adders close over their parameter.
+    {"fn adder(n) { fn add(x) { x + n } }\nvar add2 = adder(2)\nvar add10 = adder(10)\nadd2(1) * 100 + add10(1)", "311"},
+    // var always declares a variable of the function, even when a top-level
+    // variable of the same name is declared after it.
+    {"fn f() { var local = 1; local }\nf(); var local = 7; local", "7"},
+    {"fn sum(n) { var t = 0; for i = 1 in n { var t = t + i }; t }\nvar s = sum(3)\nvar t = 0\ns * 10 + t", "60"},
+    {"var t = 5\nfn f() { var t = 1; t }\nf() * 10 + t", "15"},
+    // Parameters shadow the variables of enclosing scopes.
+    {"var x = 1\nfn f(x) { var x = x + 1; x }\nf(10) * 10 + x", "111"},
+    // Closures made in a loop capture the variable of their own iteration,
+    // and assigning it changes only that iteration's.
+    {"var fs = 0\nvar gs = 0\nfor i = 1 in 2 { fn get() { i }; fn bump() { i = i + 10 }; if i == 1 { var fs = get; var gs = bump } }\ngs(); fs()", "11"},
+    {"var f1 = 0\nvar f2 = 0\nfor i = 1 in 2 { fn get() { i }; if i == 1 { var f1 = get } else { var f2 = get } }\nf1() * 10 + f2()", "12"},
+  }
+  for _, test := range tests {
+    if got := evalBoth(t, test.text); got != test.want {
+      t.Errorf("%q = %v, want %v", test.text, got, test.want)
+    }
+  }
+}
+
+func TestAssignWithoutVar(t *testing.T) {
+  tests := []struct {
+    text string
+    want string
+  }{
+    {"var n = 1\nn = n + 1\nn", "2"},
+    {"fn f() { missing = 1 }\nf()", "'missing' is not defined"},
+    {"true = 0", "Cannot reassign constant 'true'"},
+  }
+  for _, test := range tests {
+    if got := evalBoth(t, test.text); !strings.Contains(got, test.want) {
+      t.Errorf("%q = %v, want %v", test.text, got, test.want)
+    }
+  }
+}
+
+func TestClosureAssignsConst(t *testing.T) {
+  text := "fn f() { const n = 1; fn set() { n = 2 }; set() }\nf()"
+  if got := evalBoth(t, text); got != "Runtime Error: Cannot reassign constant 'n'" {
+    t.Errorf("got %v", got)
+  }
+}
+
+func TestGeneratorDone(t *testing.T) {
+  tests := []struct {
+    text string
+    want string
+  }{
+    // A generator that yields 0 is not mistaken for one that has ended.
+    {"fn zeros() { yield 0; yield 0 }\nvar g = zeros()\nvar n = 0\nwhile not g.done() { var n = n + 1 + g.next() }\nn", "2"},
+    {"fn zeros() { yield 0 }\nvar g = zeros()\nvar a = g.done()\ng.next()\na * 10 + g.done()", "1"},
+    // done keeps the value it ran the body for.
+    {"fn f() { yield 1; yield 2 }\nvar g = f()\ng.done(); g.done()\ng.next() * 10 + g.next()", "12"},
+    // An ended generator stays done, and next keeps returning null.
+    {"fn f() { return 5; yield 1 }\nvar g = f()\nvar a = g.done()\ng.next() * 10 + a + g.done()", "2"},
+    {"fn f() { yield 1 / 0 }\nf().done()", "Runtime Error: Division by zero"},
+  }
+  for _, test := range tests {
+    if got := evalBoth(t, test.text); got != test.want {
+      t.Errorf("%q = %v, want %v", test.text, got, test.want)
+    }
+  }
+}
@@ -17,18 +17,26 @@ func NewLexer(fn, text string) *Lexer {
   return l
 }
 
+type Comment struct {
+  Text string
+  PosStart Position
+  PosEnd Position
+}
+
 type Lexer struct {
   fn string
   text string
   pos Position
   current_char string
+  Comments []Comment
 }
 
 func (l *Lexer) advance() {
   l.pos.Advance(l.current_char)
 	if l.pos.idx < len(l.text) {
-		char := rune(l.text[l.pos.idx])
-		l.current_char = string(char)
+		// Bytes are kept as they are, so that text outside of ASCII in
+		// strings and comments is not decoded a second time.
+		l.current_char = l.text[l.pos.idx : l.pos.idx+1]
 	} else {
 		l.current_char = ""
 	}
@@ -39,9 +47,14 @@ func (l *Lexer) MakeTokens() ([]Token, *Error) {
   tokens := []Token{}
 
   for l.current_char != "" {
-    if l.current_char == " " || l.current_char == "\t" {
+    if l.current_char == " " || l.current_char == "\t" || l.current_char == "\r" {
       l.advance()
       continue
+    } else if l.current_char == "#" {
+      l.SkipComment()
+    } else if l.current_char == "\n" || l.current_char == ";" {
+      tokens = append(tokens, NewToken(NEWLINE, nil, &l.pos, nil))
+      l.advance()
     } else if strings.Contains(DIGITS, l.current_char) {
       tokens = append(tokens, l.MakeNumbers())
     } else if strings.Contains(LETTERS, l.current_char) {
@@ -79,6 +92,12 @@ func (l *Lexer) MakeTokens() ([]Token, *Error) {
     } else if l.current_char == "," {
       tokens = append(tokens, NewToken(COMMA, nil, &l.pos, nil))
       l.advance()
+    } else if l.current_char == ":" {
+      tokens = append(tokens, NewToken(COLON, nil, &l.pos, nil))
+      l.advance()
+    } else if l.current_char == "." {
+      tokens = append(tokens, NewToken(DOT, nil, &l.pos, nil))
+      l.advance()
     } else if l.current_char == "!" {
       tok, err := l.MakeNE()
       if err != nil { return nil, err }
@@ -101,6 +120,16 @@ func (l *Lexer) MakeTokens() ([]Token, *Error) {
   return tokens, nil
 }
 
+func (l *Lexer) SkipComment() {
+  pos_start := l.pos.Copy()
+
+  for l.current_char != "" && l.current_char != "\n" {
+    l.advance()
+  }
+  text := strings.TrimRight(l.text[pos_start.idx:l.pos.idx], " \t\r")
+  l.Comments = append(l.Comments, Comment{Text: text, PosStart: pos_start, PosEnd: l.pos.Copy()})
+}
+
 func (l *Lexer) MakePower() Token {
   pos_start := l.pos.Copy()
   l.advance()
@@ -161,6 +190,18 @@ func (l *Lexer) MakeIdentifier() Token {
   return NewToken(tok_type, id_str, &pos_start, &l.pos)
 }
 
+func isIdentifier(name string) bool {
+  if name == "" || !strings.Contains(LETTERS, name[:1]) || contains(KEYWORDS, name) {
+    return false
+  }
+  for _, char := range name {
+    if !strings.ContainsRune(LETTERS_DIGITS+"_", char) {
+      return false
+    }
+  }
+  return true
+}
+
 func (l *Lexer) MakeNE() (*Token, *Error) {
   pos_start := l.pos.Copy()
   l.advance()
@@ -240,7 +281,12 @@ func (l *Lexer) MakeString() Token {
 
   for l.current_char != "" && (l.current_char != string('"') || escapeChar) {
     if escapeChar {
-      str += EscapeChars[l.current_char]
+      if char, ok := EscapeChars[l.current_char]; ok {
+        str += char
+      } else {
+        str += l.current_char
+      }
+      escapeChar = false
     } else {
       if l.current_char == "\\" {
         escapeChar = true
@@ -249,7 +295,6 @@ func (l *Lexer) MakeString() Token {
       }
     }
     l.advance()
-    escapeChar = false
   }
   l.advance()
   return NewToken(STRING, str, &posStart, &l.pos)
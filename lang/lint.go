@@ -0,0 +1,281 @@
+package lang
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+  RuleUndefinedName = "undefined-name"
+  RuleUnusedVariable = "unused-variable"
+  RuleUnusedParameter = "unused-parameter"
+  RuleShadowedBuiltin = "shadowed-builtin"
+  RuleUnreachableCode = "unreachable-code"
+  RuleArityMismatch = "arity-mismatch"
+)
+
+type Diagnostic struct {
+  Rule string
+  Message string
+  PosStart Position
+  PosEnd Position
+}
+
+func (d Diagnostic) String() string {
+  return fmt.Sprintf("%v:%v:%v: %v [%v]", d.PosStart.fn, d.PosStart.ln+1, d.PosStart.col+1, d.Message, d.Rule)
+}
+
+// Lint checks the tree without running it. Scopes follow the interpreter:
+// only function bodies open a new scope, an assignment without var declares
+// nothing, and since names are looked up when
+// the code runs, a name counts as defined if it is declared anywhere in an
+// enclosing scope. Names found in builtins (usually NewGlobals()) are always
+// defined.
+func Lint(node Node, builtins *SymbolTable) []Diagnostic {
+  l := &linter{builtins: builtins}
+  global := newLintScope(nil, false)
+  l.collect(global, node)
+  l.check(node, global)
+
+  sort.SliceStable(l.diagnostics, func(a, b int) bool {
+    return l.diagnostics[a].PosStart.idx < l.diagnostics[b].PosStart.idx
+  })
+  return l.diagnostics
+}
+
+type lintSymbol struct {
+  kind string
+  tok Token
+  used bool
+  fn *FuncDefNode
+  declarations int
+}
+
+type lintScope struct {
+  parent *lintScope
+  symbols map[string]*lintSymbol
+  order []*lintSymbol
+  function bool
+}
+
+func newLintScope(parent *lintScope, function bool) *lintScope {
+  return &lintScope{parent: parent, symbols: make(map[string]*lintSymbol), function: function}
+}
+
+func (s *lintScope) resolve(name string) *lintSymbol {
+  for scope := s; scope != nil; scope = scope.parent {
+    if symbol, ok := scope.symbols[name]; ok {
+      return symbol
+    }
+  }
+  return nil
+}
+
+type linter struct {
+  builtins *SymbolTable
+  diagnostics []Diagnostic
+}
+
+func (l *linter) report(rule string, posStart, posEnd Position, format string, args ...any) {
+  l.diagnostics = append(l.diagnostics, Diagnostic{rule, fmt.Sprintf(format, args...), posStart, posEnd})
+}
+
+func (l *linter) isBuiltin(name string) bool {
+  return l.builtins != nil && l.builtins.Get(name) != nil
+}
+
+func (l *linter) declare(scope *lintScope, kind string, tok Token, fn *FuncDefNode) {
+  name := tok.value.(string)
+  if l.isBuiltin(name) {
+    l.report(RuleShadowedBuiltin, tok.PosStart, tok.PosEnd, "'%v' shadows a built-in", name)
+  }
+
+  symbol, ok := scope.symbols[name]
+  if !ok {
+    symbol = &lintSymbol{kind: kind, tok: tok}
+    scope.symbols[name] = symbol
+    scope.order = append(scope.order, symbol)
+  }
+  symbol.declarations += 1
+  symbol.fn = fn
+}
+
+// collect declares every name assigned in body.
+func (l *linter) collect(scope *lintScope, body Node) {
+  forEachDeclaration(body, func(kind string, tok Token, fn *FuncDefNode) {
+    l.declare(scope, kind, tok, fn)
+  })
+}
+
+func (l *linter) closeScope(scope *lintScope) {
+  if !scope.function {
+    return
+  }
+  for _, symbol := range scope.order {
+    name := symbol.tok.value.(string)
+    if symbol.used || strings.HasPrefix(name, "_") {
+      continue
+    }
+    switch symbol.kind {
+      case "variable":
+        l.report(RuleUnusedVariable, symbol.tok.PosStart, symbol.tok.PosEnd, "variable '%v' is declared but never used", name)
+      case "parameter":
+        l.report(RuleUnusedParameter, symbol.tok.PosStart, symbol.tok.PosEnd, "parameter '%v' is never used", name)
+    }
+  }
+}
+
+func (l *linter) function(node *FuncDefNode, scope *lintScope, method bool) {
+  fnScope := newLintScope(scope, true)
+  for idx, tok := range node.ArgNameToks {
+    l.declare(fnScope, "parameter", tok, nil)
+    // The receiver of a method does not have to be used.
+    if method && idx == 0 {
+      fnScope.symbols[tok.value.(string)].used = true
+    }
+  }
+
+  l.collect(fnScope, node.BodyNode)
+  l.check(node.BodyNode, fnScope)
+  l.closeScope(fnScope)
+}
+
+func terminates(node Node) bool {
+  switch n := node.(type) {
+    case *ReturnNode:
+      return true
+    case *StatementsNode:
+      for _, statement := range n.Statements {
+        if terminates(statement) {
+          return true
+        }
+      }
+    case *IfNode:
+      if n.ElseCase == nil || !terminates(n.ElseCase) {
+        return false
+      }
+      for _, Case := range n.Cases {
+        if !terminates(Case[1]) {
+          return false
+        }
+      }
+      return true
+  }
+  return false
+}
+
+func (l *linter) checkList(nodes []Node, scope *lintScope) {
+  for _, node := range nodes {
+    if node != nil {
+      l.check(node, scope)
+    }
+  }
+}
+
+func (l *linter) check(node Node, scope *lintScope) {
+  switch n := node.(type) {
+    case *NumberNode, *StringNode, *SuperNode, *ImportNode, *FromImportNode:
+    case *VarAccessNode:
+      name := n.VarName.value.(string)
+      if symbol := scope.resolve(name); symbol != nil {
+        symbol.used = true
+      } else if !l.isBuiltin(name) {
+        l.report(RuleUndefinedName, n.PosStart, n.PosEnd, "'%v' is not defined", name)
+      }
+    case *VarAssignNode:
+      l.check(n.ValueNode, scope)
+      name := n.VarName.value.(string)
+      if n.IsUpdate && scope.resolve(name) == nil && !l.isBuiltin(name) {
+        l.report(RuleUndefinedName, n.VarName.PosStart, n.VarName.PosEnd, "'%v' is not defined", name)
+      }
+    case *BinOpNode:
+      l.check(n.LeftNode, scope)
+      l.check(n.RightNode, scope)
+    case *UnaryOpNode:
+      l.check(n.Node, scope)
+    case *IfNode:
+      for _, Case := range n.Cases {
+        l.checkList(Case, scope)
+      }
+      if n.ElseCase != nil {
+        l.check(n.ElseCase, scope)
+      }
+    case *ForNode:
+      if n.Iterable != nil {
+        l.check(n.Iterable, scope)
+      } else {
+        l.check(n.StartVal, scope)
+        l.check(n.EndVal, scope)
+      }
+      if n.StepVal != nil {
+        l.check(n.StepVal, scope)
+      }
+      l.check(n.BodyNode, scope)
+    case *WhileNode:
+      l.check(n.Cond, scope)
+      l.check(n.BodyNode, scope)
+    case *FuncDefNode:
+      l.function(n, scope, false)
+    case *CallNode:
+      l.check(n.NodeToCall, scope)
+      l.checkList(n.ArgNodes, scope)
+      l.checkArity(n, scope)
+    case *StatementsNode:
+      reported := false
+      for idx, statement := range n.Statements {
+        l.check(statement, scope)
+        if !reported && terminates(statement) && idx+1 < len(n.Statements) {
+          next := n.Statements[idx+1]
+          l.report(RuleUnreachableCode, next.GetPosStart(), n.Statements[len(n.Statements)-1].GetPosEnd(), "unreachable code")
+          reported = true
+        }
+      }
+    case *ReturnNode:
+      if n.NodeToReturn != nil {
+        l.check(n.NodeToReturn, scope)
+      }
+    case *YieldNode:
+      l.check(n.Node, scope)
+    case *SpawnNode:
+      l.check(n.Call, scope)
+    case *AwaitNode:
+      l.check(n.Node, scope)
+    case *FieldAccessNode:
+      l.check(n.NodeToAccess, scope)
+    case *FieldAssignNode:
+      l.check(n.NodeToAccess, scope)
+      l.check(n.ValueNode, scope)
+    case *ClassDefNode:
+      if n.ParentNode != nil {
+        l.check(n.ParentNode, scope)
+      }
+      l.checkList(n.FieldValueNodes, scope)
+      for _, method := range n.MethodNodes {
+        l.function(method, scope, true)
+      }
+    default:
+      panic(fmt.Sprintf("Lint: unexpected node type %T", node))
+  }
+}
+
+func (l *linter) checkArity(node *CallNode, scope *lintScope) {
+  access, ok := node.NodeToCall.(*VarAccessNode)
+  if !ok {
+    return
+  }
+  name := access.VarName.value.(string)
+  symbol := scope.resolve(name)
+  // A name that is assigned more than once may hold something else by now.
+  if symbol == nil || symbol.fn == nil || symbol.declarations != 1 {
+    return
+  }
+
+  expected, got := len(symbol.fn.ArgNameToks), len(node.ArgNodes)
+  if expected != got {
+    l.report(
+      RuleArityMismatch, node.PosStart, node.PosEnd,
+      "'%v' expects %v argument(s), got %v", name, expected, got,
+    )
+  }
+}
@@ -0,0 +1,94 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+)
+
+func lintText(t *testing.T, text string) string {
+  t.Helper()
+  node, err := Parse("<test>", text)
+  if err != nil {
+    t.Fatal(err.AsString())
+  }
+  diagnostics := []string{}
+  for _, diagnostic := range Lint(node, NewGlobals()) {
+    diagnostics = append(diagnostics, diagnostic.String())
+  }
+  return strings.Join(diagnostics, "\n")
+}
+
+// TestLintRules has a program each rule reports, and one close to it that
+// it must not.
+func TestLintRules(t *testing.T) {
+  tests := []struct {
+    rule string
+    bad string
+    want string
+    good string
+  }{
+    {
+      RuleUnusedVariable,
+      "fn f() { var n = 1; 2 }\nf()", "<test>:1:14: variable 'n' is declared but never used [unused-variable]",
+      "fn f() { var n = 1; n }\nf()",
+    },
+    {
+      RuleUnusedParameter,
+      "fn f(a, b) { a }\nf(1, 2)", "<test>:1:9: parameter 'b' is never used [unused-parameter]",
+      // The receiver of a method may go unused.
+      "fn f(a, b) { a + b }\nf(1, 2)\nclass P { fn m(self) { 1 } }",
+    },
+    {
+      RuleUnreachableCode,
+      "fn f() { return 1; print(2); print(3) }\nf()", "<test>:1:20: unreachable code [unreachable-code]",
+      "fn f(x) { if x { return 1 }; print(2) }\nf(1)",
+    },
+    {
+      RuleUndefinedName,
+      "print(nothing)", "<test>:1:7: 'nothing' is not defined [undefined-name]",
+      "fn f() { later }\nvar later = 1\nf()",
+    },
+    {
+      RuleShadowedBuiltin,
+      "var len = 1\nlen", "<test>:1:5: 'len' shadows a built-in [shadowed-builtin]",
+      "var length = 1\nlength",
+    },
+    {
+      RuleArityMismatch,
+      "fn f(a) { a }\nf(1, 2)", "<test>:2:1: 'f' expects 1 argument(s), got 2 [arity-mismatch]",
+      // Names assigned more than once may hold another function by then.
+      "fn f(a) { a }\nf(1)\nvar g = 0\nfn g(a, b) { a + b }\ng(1)",
+    },
+  }
+  for _, test := range tests {
+    if got := lintText(t, test.bad); got != test.want {
+      t.Errorf("%v: %q\ngot  %v\nwant %v", test.rule, test.bad, got, test.want)
+    }
+    if got := lintText(t, test.good); got != "" {
+      t.Errorf("%v: %q: %v", test.rule, test.good, got)
+    }
+  }
+}
+
+func TestLintClosureAssignment(t *testing.T) {
+  text := "fn counter() { var n = 0; fn inc() { n = n + 1; n } }\ncounter()"
+  node, err := Parse("<test>", text)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if diagnostics := Lint(node, NewGlobals()); len(diagnostics) != 0 {
+    t.Errorf("unexpected diagnostics %v", diagnostics)
+  }
+}
+
+func TestLintAssignWithoutVar(t *testing.T) {
+  text := "fn f() { missing = 1 }\nf()"
+  node, err := Parse("<test>", text)
+  if err != nil {
+    t.Fatal(err)
+  }
+  diagnostics := Lint(node, NewGlobals())
+  if len(diagnostics) != 1 || diagnostics[0].Rule != RuleUndefinedName {
+    t.Errorf("got %v", diagnostics)
+  }
+}
@@ -0,0 +1,56 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryIsGivenBack(t *testing.T) {
+  tests := []string{
+    // Each iteration replaces the variable of the last one.
+    "var i = 0\nwhile i < 100000 { var i = i + 1 }\ni",
+    // The frames of calls that returned are given back.
+    "fn f(s) { var t = s + s; t }\nvar i = 0\nwhile i < 20000 { f(\"abcdefgh\"); var i = i + 1 }\ni",
+    // And so are the fields of instances nothing keeps anymore.
+    "class P { x; y }\nvar i = 0\nwhile i < 20000 { var p = P(i, i); p.x = i + 1; var i = i + 1 }\ni",
+  }
+  for _, text := range tests {
+    for _, vm := range []bool{false, true} {
+      got := eval(t, text, Options{VM: vm, MaxMemory: 1 << 20})
+      if strings.Contains(got, "memory limit") {
+        t.Errorf("%q (vm %v): %v", text, vm, got)
+      }
+    }
+  }
+}
+
+func TestMemoryLimit(t *testing.T) {
+  tests := []string{
+    "var s = \"abcdefgh\"\nwhile 1 { var s = s + s }",
+    "class Node { next; value }\nvar list = 0\nwhile 1 { var list = Node(list, \"abcdefgh\") }",
+    "fn grow(s, n) { if n == 0 { return s }; var t = s + \"abcdefgh\"; grow(t, n - 1) + 0 }\ngrow(\"\", 900)",
+  }
+  for _, text := range tests {
+    for _, vm := range []bool{false, true} {
+      got := eval(t, text, Options{VM: vm, MaxMemory: 1 << 16})
+      if got != "Interrupted: memory limit exceeded (65536 bytes)" {
+        t.Errorf("%q (vm %v): got %v", text, vm, got)
+      }
+    }
+  }
+}
+
+func TestMemoryStatsPeak(t *testing.T) {
+  text := "fn f() { var s = \"%v\"; s }\nvar i = 0\nwhile i < 100 { f(); var i = i + 1 }"
+  big := strings.Repeat("x", 10000)
+  for _, vm := range []bool{false, true} {
+    var stats Stats
+    if _, err := RunWithOptions("<test>", strings.Replace(text, "%v", big, 1), NewGlobals(), Options{VM: vm, Stats: &stats}); err != nil {
+      t.Fatal(err)
+    }
+    // One string is kept at a time, and briefly a copy of it as it is read.
+    if stats.Memory < 10000 || stats.Memory > 3*10000 {
+      t.Errorf("vm %v: peak of %v bytes, want one or two strings of 10000", vm, stats.Memory)
+    }
+  }
+}
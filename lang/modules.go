@@ -0,0 +1,234 @@
+package lang
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type moduleEntry struct {
+  module *Module
+  // The module that first imported this one, empty for the file a run
+  // started with.
+  importer string
+  loading bool
+  // Closed once the module is loaded or failed to.
+  done chan struct{}
+}
+
+// ModuleCache holds the modules imported by the runs given it through
+// Options.Modules, each is loaded once even when tasks import it at the same
+// time.
+type ModuleCache struct {
+  mu sync.Mutex
+  entries map[string]*moduleEntry
+}
+
+func NewModuleCache() *ModuleCache {
+  return &ModuleCache{entries: make(map[string]*moduleEntry)}
+}
+
+func resolveModulePath(importer, path string) (string, error) {
+  if !filepath.IsAbs(path) {
+    dir := "."
+    if !strings.HasPrefix(importer, "<") {
+      dir = filepath.Dir(importer)
+    }
+    path = filepath.Join(dir, path)
+  }
+  return filepath.Abs(path)
+}
+
+// ImportsFrom gives an Importer for Options that only imports the files
+// under root. Paths are relative to the importing file, or to root for
+// scripts that were not read from a file, and may not lead out of root.
+func ImportsFrom(root string) func(importer, path string) (string, error) {
+  return func(importer, path string) (string, error) {
+    root, err := filepath.Abs(root)
+    if err != nil {
+      return "", err
+    }
+    fullPath := path
+    if !filepath.IsAbs(path) {
+      dir := root
+      if !strings.HasPrefix(importer, "<") {
+        dir = filepath.Dir(importer)
+      }
+      fullPath = filepath.Join(dir, path)
+    }
+    // Symbolic links are followed to where they lead.
+    within := under(root, fullPath)
+    if real, err := filepath.EvalSymlinks(fullPath); err == nil {
+      realRoot, _ := filepath.EvalSymlinks(root)
+      within = within && under(realRoot, real)
+    }
+    if !within {
+      return "", fmt.Errorf("it is outside of the import root")
+    }
+    return fullPath, nil
+  }
+}
+
+// noImports is the Importer of engines that were not given one.
+func noImports(importer, path string) (string, error) {
+  return "", fmt.Errorf("imports are not allowed")
+}
+
+func under(root, path string) bool {
+  rel, err := filepath.Rel(root, path)
+  return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func displayPath(path string) string {
+  wd, err := os.Getwd()
+  if err != nil {
+    return path
+  }
+  rel, err := filepath.Rel(wd, path)
+  if err != nil || strings.HasPrefix(rel, "..") {
+    return path
+  }
+  return rel
+}
+
+func moduleName(path string) string {
+  return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// importers are the modules from was imported through, from first. The
+// chain ends at path when path imported from on the way.
+func (mc *ModuleCache) importers(from, path string) ([]string, bool) {
+  chain := []string{from}
+  for current := from; current != path; {
+    entry, ok := mc.entries[current]
+    if !ok || entry.importer == "" || len(chain) > len(mc.entries) {
+      return chain, false
+    }
+    current = entry.importer
+    chain = append(chain, current)
+  }
+  return chain, true
+}
+
+func (mc *ModuleCache) importChain(chain []string, path string) string {
+  parts := []string{displayPath(path)}
+  for _, module := range chain {
+    parts = append([]string{displayPath(module)}, parts...)
+  }
+  return strings.Join(parts, " -> ")
+}
+
+// enter registers the file a run starts with as loading, so that modules
+// importing it back are reported as a cycle instead of running it again.
+// It returns the path to pass to loaded, empty when the file was already
+// registered.
+func (mc *ModuleCache) enter(fn string) string {
+  if strings.HasPrefix(fn, "<") {
+    return ""
+  }
+  path, err := filepath.Abs(fn)
+  if err != nil {
+    return ""
+  }
+  mc.mu.Lock()
+  defer mc.mu.Unlock()
+  if _, ok := mc.entries[path]; ok {
+    return ""
+  }
+  mc.entries[path] = &moduleEntry{loading: true, done: make(chan struct{})}
+  return path
+}
+
+// loaded ends the loading of path, caching module unless the load failed.
+func (mc *ModuleCache) loaded(path string, module *Module, err *Error) {
+  mc.mu.Lock()
+  defer mc.mu.Unlock()
+  entry := mc.entries[path]
+  if err != nil {
+    delete(mc.entries, path)
+  } else {
+    entry.module = module
+    entry.loading = false
+  }
+  close(entry.done)
+}
+
+func (mc *ModuleCache) Import(path string, posStart, posEnd Position, context Context) (*Module, *Error) {
+  importer := posStart.fn
+  if !strings.HasPrefix(importer, "<") {
+    if abs, err := filepath.Abs(importer); err == nil {
+      importer = abs
+    }
+  }
+  resolve := resolveModulePath
+  if context.run != nil && context.run.options.Importer != nil {
+    resolve = context.run.options.Importer
+  }
+  fullPath, err := resolve(importer, path)
+  if err != nil {
+    return nil, RTError(posStart, posEnd, fmt.Sprintf("Cannot import '%v': %v", path, err), context)
+  }
+
+  // A module another task is loading is waited for, one that is being
+  // loaded on the way to this import is a cycle. Loads that failed are
+  // tried again.
+  mc.mu.Lock()
+  for {
+    entry, ok := mc.entries[fullPath]
+    if !ok {
+      break
+    }
+    if !entry.loading {
+      mc.mu.Unlock()
+      return entry.module, nil
+    }
+    if chain, cycle := mc.importers(importer, fullPath); cycle {
+      mc.mu.Unlock()
+      return nil, RTError(posStart, posEnd, fmt.Sprintf("Import cycle: %v", mc.importChain(chain, fullPath)), context)
+    }
+    mc.mu.Unlock()
+    select {
+      case <-entry.done:
+      case <-context.run.done():
+        return nil, context.run.interrupted(posStart, posEnd, context)
+    }
+    mc.mu.Lock()
+  }
+  mc.entries[fullPath] = &moduleEntry{importer: importer, loading: true, done: make(chan struct{})}
+  mc.mu.Unlock()
+
+  text, readErr := os.ReadFile(fullPath)
+  if readErr != nil {
+    err := RTError(posStart, posEnd, fmt.Sprintf("Cannot import '%v': no such file", path), context)
+    mc.loaded(fullPath, nil, err)
+    return nil, err
+  }
+
+  name := moduleName(fullPath)
+  module := NewModule(name, fullPath, NewGlobals())
+  moduleCtx := Context{
+    DisplayName: fmt.Sprintf("<module %v>", name),
+    Parent: &context,
+    ParentEntryPos: &posStart,
+    SymbolTable: module.SymbolTable,
+    Depth: context.Depth,
+    run: context.run,
+  }
+  _, runErr := execute(fullPath, string(text), moduleCtx, Options{})
+  mc.loaded(fullPath, module, runErr)
+  if runErr != nil {
+    return nil, runErr
+  }
+  return module, nil
+}
+
+// importModule imports through the cache of the run, contexts that are not
+// part of one get a cache of their own.
+func (r *runState) importModule(path string, posStart, posEnd Position, context Context) (*Module, *Error) {
+  if r == nil {
+    return NewModuleCache().Import(path, posStart, posEnd, context)
+  }
+  return r.modules.Import(path, posStart, posEnd, context)
+}
@@ -0,0 +1,158 @@
+package lang
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+  t.Helper()
+  dir := t.TempDir()
+  for name, text := range files {
+    if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+      t.Fatal(err)
+    }
+  }
+  return dir
+}
+
+func runFile(t *testing.T, path string, options Options) (any, *Error) {
+  t.Helper()
+  text, err := os.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return RunWithOptions(path, string(text), NewGlobals(), options)
+}
+
+func TestImportCycleThroughEntry(t *testing.T) {
+  dir := writeFiles(t, map[string]string{
+    "c1.scv": "import \"c2.scv\"\n",
+    "c2.scv": "import \"c1.scv\"\n",
+  })
+  c1, c2 := filepath.Join(dir, "c1.scv"), filepath.Join(dir, "c2.scv")
+  _, err := runFile(t, c1, Options{})
+  if err == nil {
+    t.Fatal("expected an import cycle")
+  }
+  want := "Import cycle: " + c1 + " -> " + c2 + " -> " + c1
+  if err.Details != want {
+    t.Errorf("got %q, want %q", err.Details, want)
+  }
+}
+
+func TestImportFromTasks(t *testing.T) {
+  dir := writeFiles(t, map[string]string{
+    "slow.scv": "var x = 0\nfor i = 1 in 20000 { var x = x + 1 }\n",
+    "main.scv": `fn load() {
+  import "slow.scv"
+  return slow.x
+}
+var a = spawn load()
+var b = spawn load()
+var c = spawn load()
+await a + await b + await c
+`,
+  })
+  for _, vm := range []bool{false, true} {
+    result, err := runFile(t, filepath.Join(dir, "main.scv"), Options{VM: vm})
+    if err != nil {
+      t.Fatalf("vm %v: %v", vm, err.AsString())
+    }
+    if got := result.(Val).String(); got != "60000" {
+      t.Errorf("vm %v: got %v, want 60000", vm, got)
+    }
+  }
+}
+
+func TestModuleCacheScope(t *testing.T) {
+  dir := writeFiles(t, map[string]string{
+    "m.scv": "var x = 1\n",
+  })
+  text := "import \"" + filepath.Join(dir, "m.scv") + "\"\nm"
+  module := func(options Options) *Module {
+    result, err := RunWithOptions("<test>", text, NewGlobals(), options)
+    if err != nil {
+      t.Fatal(err.AsString())
+    }
+    return result.(*Module)
+  }
+
+  if module(Options{}).SymbolTable == module(Options{}).SymbolTable {
+    t.Error("runs without a cache shared a module")
+  }
+  shared := Options{Modules: NewModuleCache()}
+  if module(shared).SymbolTable != module(shared).SymbolTable {
+    t.Error("runs with the same cache loaded a module twice")
+  }
+
+  engine := NewEngine()
+  engine.Options.Importer = ImportsFrom(dir)
+  first, err := engine.Run("<test>", text)
+  if err != nil {
+    t.Fatal(err)
+  }
+  second, err := engine.Run("<test>", text)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if first.(*Module).SymbolTable != second.(*Module).SymbolTable {
+    t.Error("engine runs loaded a module twice")
+  }
+}
+
+func TestImportRoot(t *testing.T) {
+  outside := writeFiles(t, map[string]string{"secret.scv": "var secret = \"hunter2\"\n"})
+  dir := writeFiles(t, map[string]string{
+    "m.scv": "var x = 1\n",
+    "up.scv": "import \"../secret.scv\"\n",
+  })
+  if err := os.Mkdir(filepath.Join(dir, "lib"), 0o755); err != nil {
+    t.Fatal(err)
+  }
+  files := map[string]string{
+    "lib/n.scv": "import \"../m.scv\"\nvar y = m.x + 1\n",
+    "lib/out.scv": "import \"../../" + filepath.Base(outside) + "/secret.scv\"\n",
+  }
+  for name, text := range files {
+    if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if err := os.Symlink(filepath.Join(outside, "secret.scv"), filepath.Join(dir, "link.scv")); err != nil {
+    t.Fatal(err)
+  }
+
+  tests := []struct {
+    importer func(importer, path string) (string, error)
+    text string
+    want string
+  }{
+    {nil, "import \"m.scv\"\nm.x", "imports are not allowed"},
+    {ImportsFrom(dir), "import \"m.scv\"\nm.x", "1"},
+    // Paths are relative to the importing module and may go up within the
+    // root.
+    {ImportsFrom(dir), "import \"lib/n.scv\"\nn.y", "2"},
+    {ImportsFrom(dir), "import \"" + filepath.Join(dir, "m.scv") + "\"\nm.x", "1"},
+    {ImportsFrom(dir), "import \"../" + filepath.Base(outside) + "/secret.scv\"", "outside of the import root"},
+    {ImportsFrom(dir), "import \"" + filepath.Join(outside, "secret.scv") + "\"", "outside of the import root"},
+    {ImportsFrom(dir), "import \"lib/out.scv\"", "outside of the import root"},
+    {ImportsFrom(dir), "import \"link.scv\"", "outside of the import root"},
+    {ImportsFrom(filepath.Join(dir, "lib")), "import \"n.scv\"", "outside of the import root"},
+  }
+  for _, test := range tests {
+    engine := NewEngine()
+    engine.Options.Importer = test.importer
+    result, err := engine.Run("<test>", test.text)
+    got := fmt.Sprint(result)
+    if err != nil {
+      got = err.Error()
+    }
+    if !strings.Contains(got, test.want) || strings.Contains(got, "hunter2") {
+      t.Errorf("%q: got %v, want %v", test.text, got, test.want)
+    }
+  }
+}
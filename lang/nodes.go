@@ -1,6 +1,10 @@
 package lang
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type Node interface {
 	String() string
@@ -8,6 +12,48 @@ type Node interface {
 	GetPosEnd() Position
 }
 
+func sexpr(head string, parts ...string) string {
+  if head != "" {
+    parts = append([]string{head}, parts...)
+  }
+  return "(" + strings.Join(parts, " ") + ")"
+}
+
+func nodeString(node Node) string {
+  if node == nil {
+    return "nil"
+  }
+  return node.String()
+}
+
+// annotated renders a name with its optional type annotation, as in "x:int".
+func annotated(name string, typeTok Token) string {
+  if typeName, _ := typeTok.value.(string); typeName != "" {
+    return name + ":" + typeName
+  }
+  return name
+}
+
+func argNames(names, types []Token) []string {
+  values := []string{}
+  for idx, tok := range names {
+    typeTok := Token{}
+    if idx < len(types) {
+      typeTok = types[idx]
+    }
+    values = append(values, annotated(fmt.Sprintf("%v", tok.value), typeTok))
+  }
+  return values
+}
+
+func tokenValues(toks []Token) []string {
+  values := []string{}
+  for _, tok := range toks {
+    values = append(values, fmt.Sprintf("%v", tok.value))
+  }
+  return values
+}
+
 type NumberNode struct {
 	Tok      Token
 	PosStart Position
@@ -15,7 +61,7 @@ type NumberNode struct {
 }
 
 func (nn NumberNode) String() string {
-  return fmt.Sprintf("%v", nn.Tok.String())
+  return sexpr("number", fmt.Sprintf("%v", nn.Tok.value))
 }
 
 func (nn *NumberNode) GetPosStart() Position {
@@ -39,7 +85,7 @@ type StringNode struct {
 }
 
 func (sn StringNode) String() string {
-  return fmt.Sprintf("%v", sn.Tok.String())
+  return sexpr("string", strconv.Quote(sn.Tok.value.(string)))
 }
 
 func (sn *StringNode) GetPosStart() Position {
@@ -64,7 +110,14 @@ type IfNode struct {
 }
 
 func (in IfNode) String() string {
-  return ""
+  parts := []string{}
+  for _, Case := range in.Cases {
+    parts = append(parts, sexpr("case", nodeString(Case[0]), nodeString(Case[1])))
+  }
+  if in.ElseCase != nil {
+    parts = append(parts, sexpr("else", nodeString(in.ElseCase)))
+  }
+  return sexpr("if", parts...)
 }
 
 func (in *IfNode) GetPosStart() Position {
@@ -87,6 +140,11 @@ func (in *IfNode) SetPos() *IfNode {
 
 type ForNode struct {
 	VarNameTok Token
+  Binding Binding
+  // Set by Resolve when every iteration needs its own frame.
+  Layout *FrameLayout
+  // Iterable is what a for-in loop runs over, the bounds are nil then.
+  Iterable Node
   StartVal Node
   EndVal Node
   StepVal Node
@@ -96,7 +154,14 @@ type ForNode struct {
 }
 
 func (fn ForNode) String() string {
-  return ""
+  if fn.Iterable != nil {
+    return sexpr("for-in", fmt.Sprintf("%v", fn.VarNameTok.value), nodeString(fn.Iterable), nodeString(fn.BodyNode))
+  }
+  return sexpr("for",
+    fmt.Sprintf("%v", fn.VarNameTok.value),
+    nodeString(fn.StartVal), nodeString(fn.EndVal), nodeString(fn.StepVal),
+    nodeString(fn.BodyNode),
+  )
 }
 
 func (fn *ForNode) GetPosStart() Position {
@@ -121,7 +186,7 @@ type WhileNode struct {
 }
 
 func (wn WhileNode) String() string {
-  return ""
+  return sexpr("while", nodeString(wn.Cond), nodeString(wn.BodyNode))
 }
 
 func (wn *WhileNode) GetPosStart() Position {
@@ -138,14 +203,23 @@ func (wn *WhileNode) SetPos() *WhileNode {
   return wn
 }
 
+// Binding records where Resolve found a variable: Depth frames up the
+// parent chain, in Slot, or by name when Slot is -1.
+type Binding struct {
+  Resolved bool
+  Depth int
+  Slot int
+}
+
 type VarAccessNode struct {
 	VarName  Token
+	Binding  Binding
 	PosStart Position
 	PosEnd   Position
 }
 
 func (van VarAccessNode) String() string {
-  return ""
+  return sexpr("var-access", fmt.Sprintf("%v", van.VarName.value))
 }
 
 func (van *VarAccessNode) GetPosStart() Position {
@@ -165,12 +239,24 @@ func (van *VarAccessNode) SetPos() *VarAccessNode {
 type VarAssignNode struct {
 	VarName     Token
   ValueNode   Node
+  IsConst     bool
+  // Set for `name = value`, which updates the nearest existing variable
+  // instead of declaring one.
+  IsUpdate    bool
+  TypeTok     Token
+  Binding     Binding
 	PosStart    Position
 	PosEnd      Position
 }
 
 func (van VarAssignNode) String() string {
-  return ""
+  head := "var"
+  if van.IsConst {
+    head = "const"
+  } else if van.IsUpdate {
+    head = "set"
+  }
+  return sexpr(head, annotated(fmt.Sprintf("%v", van.VarName.value), van.TypeTok), nodeString(van.ValueNode))
 }
 
 func (van *VarAssignNode) GetPosStart() Position {
@@ -196,7 +282,7 @@ type BinOpNode struct {
 }
 
 func (bon BinOpNode) String() string {
-  return fmt.Sprintf("(%v, %v, %v)", bon.LeftNode.String(), bon.OpTok.String(), bon.RightNode.String())
+  return sexpr("binop", bon.OpTok.Symbol(), nodeString(bon.LeftNode), nodeString(bon.RightNode))
 }
 
 func (bon *BinOpNode) GetPosStart() Position {
@@ -221,7 +307,7 @@ type UnaryOpNode struct {
 }
 
 func (uop UnaryOpNode) String() string {
-  return fmt.Sprintf("(%v, %v)", uop.OpTok, uop.Node)
+  return sexpr("unary", uop.OpTok.Symbol(), nodeString(uop.Node))
 }
 
 func (uop *UnaryOpNode) GetPosStart() Position {
@@ -241,13 +327,23 @@ func (uop *UnaryOpNode) SetPos() *UnaryOpNode {
 type FuncDefNode struct {
   VarNameTok Token
   ArgNameToks []Token
+  ArgTypeToks []Token
+  ReturnTypeTok Token
   BodyNode Node
+  Layout *FrameLayout
+  // Set by Resolve when the body yields, calls then return a generator.
+  Generator bool
   PosStart Position
   PosEnd Position
 }
 
 func (fdn FuncDefNode) String() string {
-  return ""
+  name := "nil"
+  if fdn.VarNameTok.value != nil && fdn.VarNameTok.value != "" {
+    name = fmt.Sprintf("%v", fdn.VarNameTok.value)
+  }
+  name = annotated(name, fdn.ReturnTypeTok)
+  return sexpr("fn", name, sexpr("", argNames(fdn.ArgNameToks, fdn.ArgTypeToks)...), nodeString(fdn.BodyNode))
 }
 
 func (fdn *FuncDefNode) GetPosStart() Position {
@@ -276,10 +372,17 @@ type CallNode struct {
   ArgNodes []Node
   PosStart Position
   PosEnd Position
+  // Set by Resolve when the value of the call is what the enclosing function
+  // returns.
+  Tail bool
 }
 
 func (cn CallNode) String() string {
-  return ""
+  parts := []string{nodeString(cn.NodeToCall)}
+  for _, arg := range cn.ArgNodes {
+    parts = append(parts, nodeString(arg))
+  }
+  return sexpr("call", parts...)
 }
 
 func (cn *CallNode) GetPosStart() Position {
@@ -299,3 +402,252 @@ func (cn *CallNode) SetPos() *CallNode {
   }
   return cn
 }
+
+type StatementsNode struct {
+  Statements []Node
+  PosStart Position
+  PosEnd Position
+}
+
+func (sn StatementsNode) String() string {
+  parts := []string{}
+  for _, statement := range sn.Statements {
+    parts = append(parts, nodeString(statement))
+  }
+  return sexpr("block", parts...)
+}
+
+func (sn *StatementsNode) GetPosStart() Position {
+	return sn.PosStart
+}
+
+func (sn *StatementsNode) GetPosEnd() Position {
+	return sn.PosEnd
+}
+
+type ReturnNode struct {
+  NodeToReturn Node
+  PosStart Position
+  PosEnd Position
+}
+
+func (rn ReturnNode) String() string {
+  if rn.NodeToReturn == nil {
+    return sexpr("return")
+  }
+  return sexpr("return", nodeString(rn.NodeToReturn))
+}
+
+func (rn *ReturnNode) GetPosStart() Position {
+	return rn.PosStart
+}
+
+func (rn *ReturnNode) GetPosEnd() Position {
+	return rn.PosEnd
+}
+
+// SpawnNode runs a call in a new task, AwaitNode waits for a task's result.
+type YieldNode struct {
+  Node Node
+  PosStart Position
+  PosEnd Position
+}
+
+func (yn YieldNode) String() string {
+  return sexpr("yield", nodeString(yn.Node))
+}
+
+func (yn *YieldNode) GetPosStart() Position {
+	return yn.PosStart
+}
+
+func (yn *YieldNode) GetPosEnd() Position {
+	return yn.PosEnd
+}
+
+type SpawnNode struct {
+  Call *CallNode
+  PosStart Position
+  PosEnd Position
+}
+
+func (sn SpawnNode) String() string {
+  return sexpr("spawn", nodeString(sn.Call))
+}
+
+func (sn *SpawnNode) GetPosStart() Position {
+	return sn.PosStart
+}
+
+func (sn *SpawnNode) GetPosEnd() Position {
+	return sn.PosEnd
+}
+
+type AwaitNode struct {
+  Node Node
+  PosStart Position
+  PosEnd Position
+}
+
+func (an AwaitNode) String() string {
+  return sexpr("await", nodeString(an.Node))
+}
+
+func (an *AwaitNode) GetPosStart() Position {
+	return an.PosStart
+}
+
+func (an *AwaitNode) GetPosEnd() Position {
+	return an.PosEnd
+}
+
+type FieldAccessNode struct {
+  NodeToAccess Node
+  FieldNameTok Token
+  PosStart Position
+  PosEnd Position
+}
+
+func (fan FieldAccessNode) String() string {
+  return sexpr("field", nodeString(fan.NodeToAccess), fmt.Sprintf("%v", fan.FieldNameTok.value))
+}
+
+func (fan *FieldAccessNode) GetPosStart() Position {
+	return fan.PosStart
+}
+
+func (fan *FieldAccessNode) GetPosEnd() Position {
+	return fan.PosEnd
+}
+
+func (fan *FieldAccessNode) SetPos() *FieldAccessNode {
+  fan.PosStart = fan.NodeToAccess.GetPosStart()
+  fan.PosEnd = fan.FieldNameTok.PosEnd
+  return fan
+}
+
+type FieldAssignNode struct {
+  NodeToAccess Node
+  FieldNameTok Token
+  ValueNode Node
+  PosStart Position
+  PosEnd Position
+}
+
+func (fan FieldAssignNode) String() string {
+  return sexpr("set-field", nodeString(fan.NodeToAccess), fmt.Sprintf("%v", fan.FieldNameTok.value), nodeString(fan.ValueNode))
+}
+
+func (fan *FieldAssignNode) GetPosStart() Position {
+	return fan.PosStart
+}
+
+func (fan *FieldAssignNode) GetPosEnd() Position {
+	return fan.PosEnd
+}
+
+func (fan *FieldAssignNode) SetPos() *FieldAssignNode {
+  fan.PosStart = fan.NodeToAccess.GetPosStart()
+  fan.PosEnd = fan.ValueNode.GetPosEnd()
+  return fan
+}
+
+type ClassDefNode struct {
+  ClassNameTok Token
+  ParentNode Node
+  FieldNameToks []Token
+  FieldValueNodes []Node
+  MethodNodes []*FuncDefNode
+  PosStart Position
+  PosEnd Position
+}
+
+func (cdn ClassDefNode) String() string {
+  fields := []string{}
+  for idx, tok := range cdn.FieldNameToks {
+    fields = append(fields, sexpr("", fmt.Sprintf("%v", tok.value), nodeString(cdn.FieldValueNodes[idx])))
+  }
+  methods := []string{}
+  for _, method := range cdn.MethodNodes {
+    methods = append(methods, nodeString(method))
+  }
+  return sexpr("class",
+    fmt.Sprintf("%v", cdn.ClassNameTok.value), nodeString(cdn.ParentNode),
+    sexpr("fields", fields...), sexpr("methods", methods...),
+  )
+}
+
+func (cdn *ClassDefNode) GetPosStart() Position {
+	return cdn.PosStart
+}
+
+func (cdn *ClassDefNode) GetPosEnd() Position {
+	return cdn.PosEnd
+}
+
+type SuperNode struct {
+  Tok Token
+  PosStart Position
+  PosEnd Position
+}
+
+func (sn SuperNode) String() string {
+  return sexpr("super")
+}
+
+func (sn *SuperNode) GetPosStart() Position {
+	return sn.PosStart
+}
+
+func (sn *SuperNode) GetPosEnd() Position {
+	return sn.PosEnd
+}
+
+func (sn *SuperNode) SetPos() *SuperNode {
+  sn.PosStart = sn.Tok.PosStart
+  sn.PosEnd = sn.Tok.PosEnd
+  return sn
+}
+
+type ImportNode struct {
+  PathTok Token
+  AliasTok Token
+  PosStart Position
+  PosEnd Position
+}
+
+func (in ImportNode) String() string {
+  alias := "nil"
+  if in.AliasTok.value != nil && in.AliasTok.value != "" {
+    alias = fmt.Sprintf("%v", in.AliasTok.value)
+  }
+  return sexpr("import", strconv.Quote(in.PathTok.value.(string)), alias)
+}
+
+func (in *ImportNode) GetPosStart() Position {
+	return in.PosStart
+}
+
+func (in *ImportNode) GetPosEnd() Position {
+	return in.PosEnd
+}
+
+type FromImportNode struct {
+  PathTok Token
+  NameToks []Token
+  PosStart Position
+  PosEnd Position
+}
+
+func (fin FromImportNode) String() string {
+  parts := append([]string{strconv.Quote(fin.PathTok.value.(string))}, tokenValues(fin.NameToks)...)
+  return sexpr("from-import", parts...)
+}
+
+func (fin *FromImportNode) GetPosStart() Position {
+	return fin.PosStart
+}
+
+func (fin *FromImportNode) GetPosEnd() Position {
+	return fin.PosEnd
+}
@@ -0,0 +1,101 @@
+package lang
+
+// Optimize folds operators applied to literals and drops the cases of an
+// IfNode whose condition is a literal. It runs between parsing and
+// interpretation and rewrites the tree in place. Folded nodes take the
+// positions of the expression they replace, and an operation that fails is
+// left alone so that the interpreter reports it exactly as before.
+func Optimize(node Node) Node {
+  return Transform(node, optimizeNode)
+}
+
+func optimizeNode(node Node) Node {
+  switch n := node.(type) {
+    case *BinOpNode:
+      left, right := literalValue(n.LeftNode), literalValue(n.RightNode)
+      if left == nil || right == nil {
+        return node
+      }
+      // Indexing a string panics when out of range, leave it to the runtime.
+      if _, ok := left.(*StringVal); ok && n.OpTok.type_ == DIV {
+        return node
+      }
+      result, err := binaryOp(left, n.OpTok, right)
+      if err != nil || result == nil {
+        return node
+      }
+      return literalNode(result, n.PosStart, n.PosEnd)
+    case *UnaryOpNode:
+      operand := literalValue(n.Node)
+      if operand == nil {
+        return node
+      }
+      result, err := unaryOp(n.OpTok, operand)
+      if err != nil {
+        return node
+      }
+      return literalNode(result, n.PosStart, n.PosEnd)
+    case *IfNode:
+      return pruneIf(n)
+  }
+  return node
+}
+
+func literalValue(node Node) Val {
+  // Failed operations dereference their context, so give them one.
+  context := &Context{}
+  switch n := node.(type) {
+    case *NumberNode:
+      return NewNumber(n.Tok.value).SetContext(context).SetPos(&n.PosStart, &n.PosEnd)
+    case *StringNode:
+      return NewString(n.Tok.value.(string)).SetContext(context).SetPos(&n.PosStart, &n.PosEnd)
+  }
+  return nil
+}
+
+func literalNode(value Val, posStart, posEnd Position) Node {
+  switch v := value.(type) {
+    case *Number:
+      type_ := INT
+      if _, ok := v.value.(float64); ok {
+        type_ = FLOAT
+      }
+      return &NumberNode{Tok: NewToken(type_, v.value, &posStart, &posEnd), PosStart: posStart, PosEnd: posEnd}
+    case *StringVal:
+      return &StringNode{Tok: NewToken(STRING, v.value, &posStart, &posEnd), PosStart: posStart, PosEnd: posEnd}
+  }
+  panic("literalNode: unexpected value type")
+}
+
+func pruneIf(node *IfNode) Node {
+  cases := [][]Node{}
+  elseCase := node.ElseCase
+
+  for _, Case := range node.Cases {
+    cond := literalValue(Case[0])
+    if cond == nil {
+      cases = append(cases, Case)
+      continue
+    }
+    if cond.IsTrue() {
+      elseCase = Case[1]
+      break
+    }
+  }
+
+  if len(cases) == len(node.Cases) {
+    return node
+  }
+  if len(cases) > 0 {
+    node.Cases = cases
+    node.ElseCase = elseCase
+    return node
+  }
+  if elseCase != nil {
+    return elseCase
+  }
+  // No case can match. An if without cases is left, which evaluates to what
+  // the original does when none matches.
+  node.Cases = cases
+  return node
+}
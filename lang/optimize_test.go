@@ -0,0 +1,110 @@
+package lang
+
+import (
+	"fmt"
+	"testing"
+)
+
+// runTree runs text parsed, and optimized when asked to, and gives the string
+// of its value or of its error.
+func runTree(t *testing.T, text string, optimize bool) string {
+  t.Helper()
+  node := mustParse(t, text)
+  if optimize {
+    node = Optimize(node)
+  }
+  result, err := RunAST(node, NewGlobals())
+  if err != nil {
+    return err.AsString()
+  }
+  return fmt.Sprint(result)
+}
+
+func TestOptimizeFolds(t *testing.T) {
+  tests := []struct {
+    text string
+    want string
+  }{
+    {"1 + 2 * 3", "(number 7)"},
+    {"(1 + 2) * 3 - -1", "(number 10)"},
+    {"10 / 4", "(number 2.5)"},
+    {"2 ** 10", "(number 1024)"},
+    {"\"ab\" + \"cd\"", "(string \"abcd\")"},
+    {"not 0", "(number 1)"},
+    {"1 < 2 and 3 == 3", "(number 1)"},
+    // Operands that are not literals stay.
+    {"x + 1 * 2", "(binop + (var-access x) (number 2))"},
+    // So do operations that fail, for the runtime to report.
+    {"1 / 0", "(binop / (number 1) (number 0))"},
+    {"if 0 { 1 } elif 1 { 2 } else { 3 }", "(block (number 2))"},
+    {"if x { 1 } elif 0 { 2 } else { 3 }", "(if (case (var-access x) (block (number 1))) (else (block (number 3))))"},
+  }
+  for _, test := range tests {
+    statements := Optimize(mustParse(t, test.text)).(*StatementsNode).Statements
+    if got := statements[0].String(); got != test.want {
+      t.Errorf("%q: got %v, want %v", test.text, got, test.want)
+    }
+  }
+}
+
+// The optimized tree must run exactly like the one parsed.
+func TestOptimizeKeepsResults(t *testing.T) {
+  tests := []string{
+    "if 0 { 1 }",
+    "if 0 { 1 } elif \"\" { 2 }",
+    "fn f() { if 0 { 1 } }\nf()",
+    "fn f() { if 0 { return 1 }; 2 }\nf()",
+    "if 1 { 5 } else { 6 }",
+    "if 0 { 5 } else { 6 }",
+    "var x = 1\nif 0 { 1 } elif x { 2 } else { 3 }",
+    "1 + 2 * 3",
+    "1 / 0",
+    "\"ab\" / 1",
+    "-\"ab\"",
+  }
+  for _, text := range tests {
+    if got, want := runTree(t, text, true), runTree(t, text, false); got != want {
+      t.Errorf("%q: optimized gives %v, not %v", text, got, want)
+    }
+  }
+}
+
+// Errors raised by operations on folded operands point where they would
+// without folding.
+func TestOptimizeKeepsErrorPositions(t *testing.T) {
+  tests := []string{
+    "var x = 0\n(1 + 2) / x",
+    "var s = \"a\"\n(1 + 2 * 3) - s",
+    "var s = \"a\"\ns - -(4 - 1)",
+    "fn f() { 1 }\n(\"a\" + \"b\") - f",
+  }
+  for _, text := range tests {
+    var errs [2]*Error
+    for idx, optimize := range []bool{false, true} {
+      node := mustParse(t, text)
+      if optimize {
+        node = Optimize(node)
+      }
+      if _, errs[idx] = RunAST(node, NewGlobals()); errs[idx] == nil {
+        t.Fatalf("%q: expected an error", text)
+      }
+    }
+    if errs[0].PosStart != errs[1].PosStart || errs[0].PosEnd != errs[1].PosEnd {
+      t.Errorf("%q: optimized error at %v-%v, not %v-%v", text, errs[1].PosStart.idx, errs[1].PosEnd.idx, errs[0].PosStart.idx, errs[0].PosEnd.idx)
+    }
+  }
+
+  folded := Optimize(mustParse(t, "  1 + 2 * 3")).(*StatementsNode).Statements[0]
+  if start, end := folded.GetPosStart(), folded.GetPosEnd(); start.col != 2 || end.col != 11 {
+    t.Errorf("folded node at %v to %v", start.col, end.col)
+  }
+}
+
+func mustParse(t *testing.T, text string) Node {
+  t.Helper()
+  node, err := Parse("<test>", text)
+  if err != nil {
+    t.Fatal(err)
+  }
+  return node
+}
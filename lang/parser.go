@@ -54,7 +54,7 @@ func (p *Parser) advance() Token {
 }
 
 func (p *Parser) Parse() *ParseResult {
-	res := p.expr()
+	res := p.statements()
 	if res.error == nil && p.CurrentTok.type_ != EOF {
 		start := p.CurrentTok.PosStart
 		end := p.CurrentTok.PosEnd
@@ -71,6 +71,136 @@ func (p *Parser) Parse() *ParseResult {
 	return res
 }
 
+func (p *Parser) peekPastNewlines() Token {
+  idx := p.TokIdx
+  for idx < len(p.Tokens) && p.Tokens[idx].type_ == NEWLINE {
+    idx += 1
+  }
+  if idx >= len(p.Tokens) {
+    return p.Tokens[len(p.Tokens)-1]
+  }
+  return p.Tokens[idx]
+}
+
+func (p *Parser) skipNewlines(res *ParseResult) int {
+  count := 0
+  for p.CurrentTok.type_ == NEWLINE {
+    res.register_advancement()
+    p.advance()
+    count += 1
+  }
+  return count
+}
+
+// type_annotation parses an optional `: type` (or `-> type` for return
+// types) and returns an empty token when there is none.
+func (p *Parser) type_annotation(res *ParseResult, marker string) Token {
+  if p.CurrentTok.type_ != marker {
+    return Token{value: ""}
+  }
+  res.register_advancement()
+  p.advance()
+
+  if p.CurrentTok.type_ != IDENTIFIER {
+    res.failure(InvalidSyntaxError(
+      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+      "Expected type name",
+    ))
+    return Token{value: ""}
+  }
+  type_tok := p.CurrentTok
+  res.register_advancement()
+  p.advance()
+  return type_tok
+}
+
+func (p *Parser) statements() *ParseResult {
+  res := ParseResult{}
+  statements := []Node{}
+  pos_start := p.CurrentTok.PosStart.Copy()
+
+  p.skipNewlines(&res)
+
+  for p.CurrentTok.type_ != RBRACE && p.CurrentTok.type_ != EOF {
+    statement := res.register(p.statement())
+    if res.error != nil { return &res }
+    statements = append(statements, statement)
+
+    if p.skipNewlines(&res) == 0 {
+      break
+    }
+  }
+
+  sn := &StatementsNode{Statements: statements, PosStart: pos_start, PosEnd: p.CurrentTok.PosStart.Copy()}
+  return res.success(sn)
+}
+
+func (p *Parser) statement() *ParseResult {
+  res := ParseResult{}
+  pos_start := p.CurrentTok.PosStart.Copy()
+
+  if p.CurrentTok.Matches(KEYWORD, "return") {
+    pos_end := p.CurrentTok.PosEnd.Copy()
+    res.register_advancement()
+    p.advance()
+
+    var expr Node
+    if !contains([]string{NEWLINE, RBRACE, EOF}, p.CurrentTok.type_) {
+      expr = res.register(p.expr())
+      if res.error != nil { return &res }
+      pos_end = expr.GetPosEnd()
+    }
+    return res.success(&ReturnNode{NodeToReturn: expr, PosStart: pos_start, PosEnd: pos_end})
+  } else if p.CurrentTok.Matches(KEYWORD, "yield") {
+    res.register_advancement()
+    p.advance()
+
+    expr := res.register(p.expr())
+    if res.error != nil { return &res }
+    return res.success(&YieldNode{Node: expr, PosStart: pos_start, PosEnd: expr.GetPosEnd()})
+  } else if p.CurrentTok.Matches(KEYWORD, "import") {
+    return p.import_stmt()
+  } else if p.CurrentTok.Matches(KEYWORD, "from") {
+    return p.from_import_stmt()
+  }
+
+  expr := res.register(p.expr())
+  if res.error != nil {
+    return res.failure(InvalidSyntaxError(
+      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+      "Expected 'return', 'yield', 'import', 'from', 'var', 'const', 'if', 'for', 'while', 'fn', 'class', 'not', int, float, identifier, '+', '-', '('",
+    ))
+  }
+  return res.success(expr)
+}
+
+func (p *Parser) block() *ParseResult {
+  res := ParseResult{}
+
+  if p.CurrentTok.type_ != LBRACE {
+    return res.failure(InvalidSyntaxError(
+      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+      "Expected '{'",
+    ))
+  }
+  res.register_advancement()
+  p.advance()
+
+  body := res.register(p.statements())
+  if res.error != nil { return &res }
+
+  if p.CurrentTok.type_ != RBRACE {
+    return res.failure(InvalidSyntaxError(
+      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+      "Expected '}'",
+    ))
+  }
+  res.register_advancement()
+  p.advance()
+
+  return res.success(body)
+}
+
 func (p *Parser) power() *ParseResult {
   return p.binOp(p.call, []any{POW, POW}, p.factor)
 }
@@ -80,7 +210,24 @@ func (p *Parser) call() *ParseResult {
   atom := res.register(p.atom())
   if res.error != nil { return &res }
 
-  if p.CurrentTok.type_ == LPAREN {
+  for p.CurrentTok.type_ == LPAREN || p.CurrentTok.type_ == DOT {
+    if p.CurrentTok.type_ == DOT {
+      res.register_advancement()
+      p.advance()
+
+      if p.CurrentTok.type_ != IDENTIFIER {
+        return res.failure(InvalidSyntaxError(
+          p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+          "Expected identifier",
+        ))
+      }
+      fan := &FieldAccessNode{NodeToAccess: atom, FieldNameTok: p.CurrentTok}
+      res.register_advancement()
+      p.advance()
+      atom = fan.SetPos()
+      continue
+    }
+
     res.register_advancement()
     p.advance()
     var arg_nodes []Node
@@ -113,7 +260,7 @@ func (p *Parser) call() *ParseResult {
       p.advance()
     }
     cn := &CallNode{NodeToCall: atom, ArgNodes: arg_nodes}
-    return res.success(cn.SetPos())
+    atom = cn.SetPos()
   }
   return res.success(atom)
 }
@@ -170,11 +317,20 @@ func (p *Parser) atom() *ParseResult {
     func_def := res.register(p.func_def())
     if res.error != nil { return res }
     return res.success(func_def)
+  } else if tok.Matches(KEYWORD, "class") {
+    class_def := res.register(p.class_def())
+    if res.error != nil { return res }
+    return res.success(class_def)
+  } else if tok.Matches(KEYWORD, "super") {
+    res.register_advancement()
+    p.advance()
+    sn := &SuperNode{Tok: tok}
+    return res.success(sn.SetPos())
   }
 
   return res.failure(InvalidSyntaxError(
     p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-    "Expected 'if', 'for', 'while', 'fn', int, float, identifier, '+', '-', '('",
+    "Expected 'if', 'for', 'while', 'fn', 'class', int, float, identifier, '+', '-', '('",
   ))
 }
 
@@ -193,6 +349,29 @@ func (p *Parser) factor() *ParseResult {
 		return res.success(uop.SetPos())
 	}
 
+  if tok.Matches(KEYWORD, "spawn") {
+    res.register_advancement()
+    p.advance()
+    node := res.register(p.call())
+    if res.error != nil { return res }
+    call, ok := node.(*CallNode)
+    if !ok {
+      return res.failure(InvalidSyntaxError(
+        node.GetPosStart(), node.GetPosEnd(),
+        "Expected a call after 'spawn'",
+      ))
+    }
+    return res.success(&SpawnNode{Call: call, PosStart: tok.PosStart, PosEnd: call.PosEnd})
+  }
+
+  if tok.Matches(KEYWORD, "await") {
+    res.register_advancement()
+    p.advance()
+    node := res.register(p.factor())
+    if res.error != nil { return res }
+    return res.success(&AwaitNode{Node: node, PosStart: tok.PosStart, PosEnd: node.GetPosEnd()})
+  }
+
 	return p.power()
 }
 
@@ -231,7 +410,8 @@ func (p *Parser) comp_expr() *ParseResult {
 func (p *Parser) expr() *ParseResult {
   res := ParseResult{}
 
-  if p.CurrentTok.Matches(KEYWORD, "var") {
+  if p.CurrentTok.Matches(KEYWORD, "var") || p.CurrentTok.Matches(KEYWORD, "const") {
+    is_const := p.CurrentTok.Matches(KEYWORD, "const")
     res.register_advancement()
 		p.advance()
 
@@ -245,6 +425,9 @@ func (p *Parser) expr() *ParseResult {
     res.register_advancement()
 		p.advance()
 
+    type_tok := p.type_annotation(&res, COLON)
+    if res.error != nil { return &res }
+
     if p.CurrentTok.type_ != EQ {
       return res.failure(InvalidSyntaxError(
         p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
@@ -255,7 +438,7 @@ func (p *Parser) expr() *ParseResult {
 		p.advance()
     expr := res.register(p.expr())
     if res.error != nil { return &res }
-    van := &VarAssignNode{VarName: var_name, ValueNode: expr}
+    van := &VarAssignNode{VarName: var_name, ValueNode: expr, IsConst: is_const, TypeTok: type_tok}
     return res.success(van.SetPos())
   }
 
@@ -266,6 +449,23 @@ func (p *Parser) expr() *ParseResult {
       "Expected 'var', 'if', 'for', 'while', 'not', int, float, identifier, '+', '-', '('",
     ))
   }
+
+  if van, ok := node.(*VarAccessNode); ok && p.CurrentTok.type_ == EQ {
+    res.register_advancement()
+    p.advance()
+    expr := res.register(p.expr())
+    if res.error != nil { return &res }
+    vasn := &VarAssignNode{VarName: van.VarName, ValueNode: expr, IsUpdate: true}
+    return res.success(vasn.SetPos())
+  }
+  if fan, ok := node.(*FieldAccessNode); ok && p.CurrentTok.type_ == EQ {
+    res.register_advancement()
+    p.advance()
+    expr := res.register(p.expr())
+    if res.error != nil { return &res }
+    fasn := &FieldAssignNode{NodeToAccess: fan.NodeToAccess, FieldNameTok: fan.FieldNameTok, ValueNode: expr}
+    return res.success(fasn.SetPos())
+  }
   return res.success(node)
 }
 
@@ -286,81 +486,29 @@ func (p *Parser) if_expr() *ParseResult {
   condition := res.register(p.expr())
   if res.error != nil { return &res }
 
-  if p.CurrentTok.type_ != LBRACE {
-    return res.failure(InvalidSyntaxError(
-      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '{'",
-    ))
-  }
-  res.register_advancement()
-  p.advance()
-
-  expr := res.register(p.expr())
+  expr := res.register(p.block())
   if res.error != nil { return &res }
   cases = append(cases, []Node{condition, expr})
 
-  if p.CurrentTok.type_ != RBRACE {
-    return res.failure(InvalidSyntaxError(
-      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '}'",
-    ))
-  }
-  res.register_advancement()
-  p.advance()
-
-  for p.CurrentTok.Matches(KEYWORD, "elif") {
+  for p.peekPastNewlines().Matches(KEYWORD, "elif") {
+    p.skipNewlines(&res)
     res.register_advancement()
     p.advance()
 
     condition := res.register(p.expr())
     if res.error != nil { return &res }
 
-    if p.CurrentTok.type_ != LBRACE {
-      return res.failure(InvalidSyntaxError(
-        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-        "Expected '{'",
-      ))
-    }
-    res.register_advancement()
-    p.advance()
-
-    expr := res.register(p.expr())
+    expr := res.register(p.block())
     if res.error != nil { return &res }
     cases = append(cases, []Node{condition, expr})
-
-    if p.CurrentTok.type_ != RBRACE {
-      return res.failure(InvalidSyntaxError(
-        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-        "Expected '}'",
-      ))
-    }
-    res.register_advancement()
-    p.advance()
   }
-  if p.CurrentTok.Matches(KEYWORD, "else") {
+  if p.peekPastNewlines().Matches(KEYWORD, "else") {
+    p.skipNewlines(&res)
     res.register_advancement()
     p.advance()
 
-    if p.CurrentTok.type_ != LBRACE {
-      return res.failure(InvalidSyntaxError(
-        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-        "Expected '{'",
-      ))
-    }
-    res.register_advancement()
-    p.advance()
-
-    else_case = res.register(p.expr())
+    else_case = res.register(p.block())
     if res.error != nil { return &res }
-
-    if p.CurrentTok.type_ != RBRACE {
-      return res.failure(InvalidSyntaxError(
-        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-        "Expected '}'",
-      ))
-    }
-    res.register_advancement()
-    p.advance()
   }
   in := &IfNode{Cases: cases, ElseCase: else_case}
   return res.success(in.SetPos())
@@ -388,10 +536,23 @@ func (p *Parser) for_expr() *ParseResult {
   res.register_advancement()
   p.advance()
 
+  if p.CurrentTok.Matches(KEYWORD, "in") {
+    res.register_advancement()
+    p.advance()
+
+    iterable := res.register(p.expr())
+    if res.error != nil { return &res }
+    body := res.register(p.block())
+    if res.error != nil { return &res }
+
+    fn := &ForNode{VarNameTok: varName, Iterable: iterable, BodyNode: body}
+    return res.success(fn.SetPos())
+  }
+
   if p.CurrentTok.type_ != EQ {
     return res.failure(InvalidSyntaxError(
       p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '='",
+      "Expected '=' or 'in'",
     ))
   }
   res.register_advancement()
@@ -423,26 +584,8 @@ func (p *Parser) for_expr() *ParseResult {
     stepVal = nil
   }
 
-  if p.CurrentTok.type_ != LBRACE {
-    return res.failure(InvalidSyntaxError(
-      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '{'",
-    ))
-  }
-  res.register_advancement()
-  p.advance()
-  
-  body := res.register(p.expr())
-  if res.error != nil { return nil }
-
-  if p.CurrentTok.type_ != RBRACE {
-    return res.failure(InvalidSyntaxError(
-      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '}'",
-    ))
-  }
-  res.register_advancement()
-  p.advance()
+  body := res.register(p.block())
+  if res.error != nil { return &res }
 
   fn := &ForNode{VarNameTok: varName, StartVal: startVal, EndVal: endVal, StepVal: stepVal, BodyNode: body}
   return res.success(fn.SetPos())
@@ -463,27 +606,9 @@ func (p *Parser) while_expr() *ParseResult {
   condition := res.register(p.expr())
   if res.error != nil { return &res }
 
-  if p.CurrentTok.type_ != LBRACE {
-    return res.failure(InvalidSyntaxError(
-      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '{'",
-    ))
-  }
-  res.register_advancement()
-  p.advance()
-
-  body := res.register(p.expr())
+  body := res.register(p.block())
   if res.error != nil { return &res }
 
-  if p.CurrentTok.type_ != RBRACE {
-    return res.failure(InvalidSyntaxError(
-      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '}'",
-    ))
-  }
-  res.register_advancement()
-  p.advance()
-  
   wn := &WhileNode{Cond: condition, BodyNode: body}
   return res.success(wn.SetPos())
 }
@@ -523,11 +648,14 @@ func (p *Parser) func_def() *ParseResult {
   res.register_advancement()
   p.advance()
   var arg_name_toks []Token
+  var arg_type_toks []Token
 
   if p.CurrentTok.type_ == IDENTIFIER {
     arg_name_toks = append(arg_name_toks, p.CurrentTok)
     res.register_advancement()
     p.advance()
+    arg_type_toks = append(arg_type_toks, p.type_annotation(&res, COLON))
+    if res.error != nil { return &res }
 
     for p.CurrentTok.type_ == COMMA {
       res.register_advancement()
@@ -542,6 +670,8 @@ func (p *Parser) func_def() *ParseResult {
       arg_name_toks = append(arg_name_toks, p.CurrentTok)
       res.register_advancement()
       p.advance()
+      arg_type_toks = append(arg_type_toks, p.type_annotation(&res, COLON))
+      if res.error != nil { return &res }
     }
 
     if p.CurrentTok.type_ != RPAREN {
@@ -561,29 +691,211 @@ func (p *Parser) func_def() *ParseResult {
   res.register_advancement()
   p.advance()
 
+  return_type_tok := p.type_annotation(&res, ARROW)
+  if res.error != nil { return &res }
+
+  body := res.register(p.block())
+  if res.error != nil { return &res }
+
+  fn := &FuncDefNode{
+    VarNameTok: var_name_tok, ArgNameToks: arg_name_toks, ArgTypeToks: arg_type_toks,
+    ReturnTypeTok: return_type_tok, BodyNode: body,
+  }
+  return res.success(fn.SetPos())
+}
+
+func (p *Parser) class_def() *ParseResult {
+  res := ParseResult{}
+
+  if !p.CurrentTok.Matches(KEYWORD, "class") {
+    return res.failure(InvalidSyntaxError(
+      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+      "Expected 'class'",
+    ))
+  }
+  pos_start := p.CurrentTok.PosStart.Copy()
+  res.register_advancement()
+  p.advance()
+
+  if p.CurrentTok.type_ != IDENTIFIER {
+    return res.failure(InvalidSyntaxError(
+      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+      "Expected identifier",
+    ))
+  }
+  class_name_tok := p.CurrentTok
+  res.register_advancement()
+  p.advance()
+
+  var parent_node Node
+  if p.CurrentTok.type_ == LPAREN {
+    res.register_advancement()
+    p.advance()
+
+    parent_node = res.register(p.expr())
+    if res.error != nil { return &res }
+
+    if p.CurrentTok.type_ != RPAREN {
+      return res.failure(InvalidSyntaxError(
+        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+        "Expected ')'",
+      ))
+    }
+    res.register_advancement()
+    p.advance()
+  }
+
   if p.CurrentTok.type_ != LBRACE {
     return res.failure(InvalidSyntaxError(
       p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '{'",
+      "Expected '(' or '{'",
     ))
   }
   res.register_advancement()
   p.advance()
 
-  body := res.register(p.expr())
-  if res.error != nil { return &res }
+  var field_name_toks []Token
+  var field_value_nodes []Node
+  var method_nodes []*FuncDefNode
+
+  p.skipNewlines(&res)
+  for p.CurrentTok.type_ != RBRACE {
+    if p.CurrentTok.Matches(KEYWORD, "fn") {
+      method := res.register(p.func_def())
+      if res.error != nil { return &res }
+      fdn := method.(*FuncDefNode)
+      if fdn.VarNameTok.value == "" {
+        return res.failure(InvalidSyntaxError(
+          fdn.PosStart, fdn.PosEnd,
+          "Expected method name",
+        ))
+      }
+      method_nodes = append(method_nodes, fdn)
+    } else if p.CurrentTok.type_ == IDENTIFIER {
+      field_name_toks = append(field_name_toks, p.CurrentTok)
+      res.register_advancement()
+      p.advance()
 
-  if p.CurrentTok.type_ != RBRACE {
+      var value_node Node
+      if p.CurrentTok.type_ == EQ {
+        res.register_advancement()
+        p.advance()
+        value_node = res.register(p.expr())
+        if res.error != nil { return &res }
+      }
+      field_value_nodes = append(field_value_nodes, value_node)
+    } else {
+      return res.failure(InvalidSyntaxError(
+        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+        "Expected 'fn', identifier or '}'",
+      ))
+    }
+
+    if p.skipNewlines(&res) == 0 && p.CurrentTok.type_ != RBRACE {
+      return res.failure(InvalidSyntaxError(
+        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+        "Expected ';', newline or '}'",
+      ))
+    }
+  }
+  pos_end := p.CurrentTok.PosEnd.Copy()
+  res.register_advancement()
+  p.advance()
+
+  return res.success(&ClassDefNode{
+    ClassNameTok: class_name_tok,
+    ParentNode: parent_node,
+    FieldNameToks: field_name_toks,
+    FieldValueNodes: field_value_nodes,
+    MethodNodes: method_nodes,
+    PosStart: pos_start,
+    PosEnd: pos_end,
+  })
+}
+
+func (p *Parser) import_stmt() *ParseResult {
+  res := ParseResult{}
+  pos_start := p.CurrentTok.PosStart.Copy()
+  res.register_advancement()
+  p.advance()
+
+  if p.CurrentTok.type_ != STRING {
     return res.failure(InvalidSyntaxError(
       p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
-      "Expected '}'",
+      "Expected string",
     ))
   }
+  path_tok := p.CurrentTok
+  pos_end := p.CurrentTok.PosEnd.Copy()
   res.register_advancement()
   p.advance()
 
-  fn := &FuncDefNode{VarNameTok: var_name_tok, ArgNameToks: arg_name_toks, BodyNode: body}
-  return res.success(fn.SetPos())
+  alias_tok := Token{value: ""}
+  if p.CurrentTok.Matches(KEYWORD, "as") {
+    res.register_advancement()
+    p.advance()
+
+    if p.CurrentTok.type_ != IDENTIFIER {
+      return res.failure(InvalidSyntaxError(
+        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+        "Expected identifier",
+      ))
+    }
+    alias_tok = p.CurrentTok
+    pos_end = p.CurrentTok.PosEnd.Copy()
+    res.register_advancement()
+    p.advance()
+  }
+
+  return res.success(&ImportNode{PathTok: path_tok, AliasTok: alias_tok, PosStart: pos_start, PosEnd: pos_end})
+}
+
+func (p *Parser) from_import_stmt() *ParseResult {
+  res := ParseResult{}
+  pos_start := p.CurrentTok.PosStart.Copy()
+  res.register_advancement()
+  p.advance()
+
+  if p.CurrentTok.type_ != STRING {
+    return res.failure(InvalidSyntaxError(
+      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+      "Expected string",
+    ))
+  }
+  path_tok := p.CurrentTok
+  res.register_advancement()
+  p.advance()
+
+  if !p.CurrentTok.Matches(KEYWORD, "import") {
+    return res.failure(InvalidSyntaxError(
+      p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+      "Expected 'import'",
+    ))
+  }
+  res.register_advancement()
+  p.advance()
+
+  var name_toks []Token
+  for {
+    if p.CurrentTok.type_ != IDENTIFIER {
+      return res.failure(InvalidSyntaxError(
+        p.CurrentTok.PosStart, p.CurrentTok.PosEnd,
+        "Expected identifier",
+      ))
+    }
+    name_toks = append(name_toks, p.CurrentTok)
+    res.register_advancement()
+    p.advance()
+
+    if p.CurrentTok.type_ != COMMA {
+      break
+    }
+    res.register_advancement()
+    p.advance()
+  }
+
+  pos_end := name_toks[len(name_toks)-1].PosEnd
+  return res.success(&FromImportNode{PathTok: path_tok, NameToks: name_toks, PosStart: pos_start, PosEnd: pos_end})
 }
 
 func (p *Parser) binOp(fna func() *ParseResult, ops []any, fnb func() *ParseResult) *ParseResult {
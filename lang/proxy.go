@@ -0,0 +1,257 @@
+package lang
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// GoObject lets scripts use a Go struct through a pointer to it: its exported
+// fields can be read and assigned and its exported methods called. Scripts
+// see the names in snake_case, OrderID as order_id, unless a field has a
+// `scenev:"name"` tag; `scenev:"-"` hides it. The struct is used as it is,
+// so tasks sharing it need it to be safe for concurrent use.
+//
+// When allow lists names, only those are shown. A struct field such as
+// address, or a pointer to a struct, is then shown without any of its own
+// fields, address.city shows address and its field city. Structs that
+// methods return show none of theirs.
+func NewGoObject(ptr any, allow ...string) (*GoObject, error) {
+  rv := reflect.ValueOf(ptr)
+  if rv.Kind() != reflect.Pointer || rv.Type().Elem().Kind() != reflect.Struct || rv.IsNil() {
+    return nil, fmt.Errorf("cannot wrap %T, expected a pointer to a struct", ptr)
+  }
+  return wrapObject(rv, allow, len(allow) > 0)
+}
+
+// wrapObject wraps the struct rv points to, showing only the names allow
+// lists when restricted.
+func wrapObject(rv reflect.Value, allow []string, restricted bool) (*GoObject, error) {
+  o := &GoObject{ptr: rv, info: structInfoOf(rv.Type())}
+  if restricted {
+    o.allowed = make(map[string][]string)
+    for _, path := range allow {
+      name, rest, nested := strings.Cut(path, ".")
+      index, isField := o.info.fields[name]
+      if !isField && o.info.methods[name] == nil {
+        return nil, fmt.Errorf("%v has no field or method '%v'", rv.Type().Elem(), name)
+      }
+      below := o.allowed[name]
+      if nested {
+        if !isField {
+          return nil, fmt.Errorf("'%v' of %v is a method, not a struct", name, rv.Type().Elem())
+        }
+        fieldType := rv.Type().Elem().FieldByIndex(index).Type
+        if fieldType.Kind() == reflect.Pointer {
+          fieldType = fieldType.Elem()
+        }
+        if fieldType.Kind() != reflect.Struct {
+          return nil, fmt.Errorf("field '%v' of %v is not a struct", name, rv.Type().Elem())
+        }
+        if _, err := wrapObject(reflect.New(fieldType), []string{rest}, true); err != nil {
+          return nil, err
+        }
+        below = append(below, rest)
+      }
+      o.allowed[name] = below
+    }
+  }
+  o.SetPos(nil, nil)
+  o.SetContext(nil)
+  return o, nil
+}
+
+type GoObject struct {
+  Value
+  ptr reflect.Value
+  info *structInfo
+  // The names scripts may use, with what they may use of the objects given
+  // for struct fields. All of them when nil.
+  allowed map[string][]string
+}
+
+type structInfo struct {
+  name string
+  fields map[string][]int
+  // The fields in declaration order, for String.
+  order []string
+  methods map[string]*reflect.Method
+}
+
+var structInfos sync.Map
+
+func structInfoOf(ptrType reflect.Type) *structInfo {
+  if info, ok := structInfos.Load(ptrType); ok {
+    return info.(*structInfo)
+  }
+  t := ptrType.Elem()
+  info := &structInfo{name: t.Name(), fields: make(map[string][]int), methods: make(map[string]*reflect.Method)}
+  for _, field := range reflect.VisibleFields(t) {
+    if !field.IsExported() || field.Anonymous {
+      continue
+    }
+    name := snakeCase(field.Name)
+    if tag, ok := field.Tag.Lookup("scenev"); ok {
+      if tag == "-" {
+        continue
+      }
+      name = tag
+    }
+    info.fields[name] = field.Index
+    info.order = append(info.order, name)
+  }
+  for idx := range ptrType.NumMethod() {
+    method := ptrType.Method(idx)
+    info.methods[snakeCase(method.Name)] = &method
+  }
+  actual, _ := structInfos.LoadOrStore(ptrType, info)
+  return actual.(*structInfo)
+}
+
+// snakeCase maps a Go name to the one scripts use: AddItem to add_item and
+// HTTPServer to http_server.
+func snakeCase(name string) string {
+  runes := []rune(name)
+  var sb strings.Builder
+  for idx, r := range runes {
+    if unicode.IsUpper(r) {
+      prevLower := idx > 0 && !unicode.IsUpper(runes[idx-1])
+      acronymEnd := idx > 0 && idx+1 < len(runes) && unicode.IsUpper(runes[idx-1]) && unicode.IsLower(runes[idx+1])
+      if prevLower || acronymEnd {
+        sb.WriteRune('_')
+      }
+      r = unicode.ToLower(r)
+    }
+    sb.WriteRune(r)
+  }
+  return sb.String()
+}
+
+// Pointer returns the pointer the object wraps.
+func (o *GoObject) Pointer() any {
+  return o.ptr.Interface()
+}
+
+func (o *GoObject) visible(name string) bool {
+  if o.allowed == nil {
+    return true
+  }
+  _, ok := o.allowed[name]
+  return ok
+}
+
+// field returns the field name, not valid when the struct has no such field
+// or one of the structs it is promoted from is a nil pointer.
+func (o *GoObject) field(name string) (reflect.Value, bool) {
+  index, ok := o.info.fields[name]
+  if !ok || !o.visible(name) {
+    return reflect.Value{}, false
+  }
+  field, err := o.ptr.Elem().FieldByIndexErr(index)
+  return field, err == nil
+}
+
+// Lookup returns the field or method name, a field that cannot be converted
+// is an error. Fields that are structs are given as objects that write
+// through to this one. They, the structs fields point to and those methods
+// return only show what this one allows of them, which for methods is
+// nothing.
+func (o *GoObject) Lookup(name string) (Val, error) {
+  if field, ok := o.field(name); ok {
+    if field.Kind() == reflect.Struct {
+      return wrapObject(field.Addr(), o.allowed[name], o.allowed != nil)
+    }
+    value, err := toVal(name, field.Interface(), o.allowed[name], o.allowed != nil)
+    if err != nil {
+      return nil, fmt.Errorf("field '%v': %w", name, err)
+    }
+    return value, nil
+  }
+  if method := o.info.methods[name]; method != nil && o.visible(name) {
+    return wrapFunc(name, o.ptr.Method(method.Index), nil, o.allowed != nil)
+  }
+  return nil, fmt.Errorf("%v has no field '%v'", describe(o), name)
+}
+
+// Assign sets the field name to value converted to the field's type.
+func (o *GoObject) Assign(name string, value Val) error {
+  field, ok := o.field(name)
+  if !ok {
+    return fmt.Errorf("%v has no field '%v'", describe(o), name)
+  }
+  converted, err := fromVal(value, field.Type())
+  if err != nil {
+    return fmt.Errorf("field '%v': %w", name, err)
+  }
+  field.Set(converted)
+  return nil
+}
+
+func (o *GoObject) GetField(name string) Val {
+  value, _ := o.Lookup(name)
+  return value
+}
+
+func (o *GoObject) SetField(name string, value Val) bool {
+  return o.Assign(name, value) == nil
+}
+
+func (o *GoObject) CompEQ(other Val) (Val, *Error) {
+  o2, ok := other.(*GoObject)
+  return NewNumber(BoolToInt(ok && o.ptr.Equal(o2.ptr))).SetContext(o.Context), nil
+}
+
+func (o *GoObject) CompNE(other Val) (Val, *Error) {
+  o2, ok := other.(*GoObject)
+  return NewNumber(BoolToInt(!ok || !o.ptr.Equal(o2.ptr))).SetContext(o.Context), nil
+}
+
+func (o *GoObject) SetPos(pos_start, pos_end *Position) Val {
+  o.PosStart = pos_start
+  o.PosEnd = pos_end
+  return o
+}
+
+func (o *GoObject) SetContext(context *Context) Val {
+  o.Context = context
+  return o
+}
+
+func (o *GoObject) Copy() Val {
+  copy := *o
+  return &copy
+}
+
+func (o *GoObject) IsTrue() bool {
+  return true
+}
+
+// String is that of fmt.Stringer when the struct has one, otherwise the
+// fields like an instance's.
+func (o GoObject) String() string {
+  return o.show(map[any]bool{})
+}
+
+func (o GoObject) show(seen map[any]bool) string {
+  if stringer, ok := o.ptr.Interface().(fmt.Stringer); ok {
+    return stringer.String()
+  }
+  if seen[o.ptr.Pointer()] {
+    return describe(&o)
+  }
+  seen[o.ptr.Pointer()] = true
+  defer delete(seen, o.ptr.Pointer())
+  parts := []string{}
+  for _, name := range o.info.order {
+    if field, ok := o.field(name); ok {
+      value, err := toVal(name, field.Interface(), o.allowed[name], o.allowed != nil)
+      if err != nil {
+        continue
+      }
+      parts = append(parts, fmt.Sprintf("%v=%v", name, describeIn(value, seen)))
+    }
+  }
+  return o.info.name + "(" + strings.Join(parts, ", ") + ")"
+}
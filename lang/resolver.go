@@ -0,0 +1,191 @@
+package lang
+
+// forEachDeclaration calls f for every name that body assigns in its own
+// scope, without descending into nested function bodies. fn is set for
+// named function definitions.
+func forEachDeclaration(body Node, f func(kind string, tok Token, fn *FuncDefNode)) {
+  Inspect(body, func(node Node) bool {
+    switch n := node.(type) {
+      case *VarAssignNode:
+        if !n.IsUpdate {
+          f("variable", n.VarName, nil)
+        }
+      case *ForNode:
+        f("loop", n.VarNameTok, nil)
+      case *FuncDefNode:
+        if name, _ := n.VarNameTok.value.(string); name != "" {
+          f("function", n.VarNameTok, n)
+        }
+        return false
+      case *ClassDefNode:
+        f("class", n.ClassNameTok, nil)
+      case *ImportNode:
+        if alias, _ := n.AliasTok.value.(string); alias != "" {
+          f("import", n.AliasTok, nil)
+        } else if name := moduleName(n.PathTok.value.(string)); isIdentifier(name) {
+          f("import", NewToken(IDENTIFIER, name, &n.PathTok.PosStart, &n.PathTok.PosEnd), nil)
+        }
+      case *FromImportNode:
+        for _, tok := range n.NameToks {
+          f("import", tok, nil)
+        }
+    }
+    return true
+  })
+}
+
+type resolverScope struct {
+  parent *resolverScope
+  layout *FrameLayout
+  // The scope of a loop body that only holds the loop variable.
+  iteration bool
+}
+
+// Resolve binds every variable to a slot of its function frame, or marks it
+// as a lookup by name when it lives in the global table (which the REPL and
+// imports keep growing at runtime). The tree is annotated in place and can be
+// resolved again safely.
+//
+// Functions close over the frames they are defined in by reference, so they
+// see later assignments there. var always declares in the function's own
+// frame; `name = value` updates the nearest variable of that name instead,
+// which is how a closure changes what it captured. A for loop whose body
+// defines functions gets a frame per iteration for its variable, which makes
+// every iteration's closures capture their own value.
+func Resolve(node Node) {
+  resolveNode(node, &resolverScope{})
+}
+
+func (s *resolverScope) lookup(name string) Binding {
+  depth := 0
+  for scope := s; scope.layout != nil; scope = scope.parent {
+    if slot, ok := scope.layout.Index[name]; ok {
+      return Binding{Resolved: true, Depth: depth, Slot: slot}
+    }
+    depth += 1
+  }
+  return Binding{Resolved: true, Depth: depth, Slot: -1}
+}
+
+// local binds a declaration. Inside loop bodies only the loop variable
+// belongs to the iteration, everything else goes to the enclosing frame.
+func (s *resolverScope) local(name string) Binding {
+  depth := 0
+  scope := s
+  for scope.iteration {
+    if slot, ok := scope.layout.Index[name]; ok {
+      return Binding{Resolved: true, Depth: depth, Slot: slot}
+    }
+    depth += 1
+    scope = scope.parent
+  }
+  if scope.layout == nil {
+    return Binding{Resolved: true, Depth: depth, Slot: -1}
+  }
+  return Binding{Resolved: true, Depth: depth, Slot: scope.layout.Index[name]}
+}
+
+func resolveFunction(node *FuncDefNode, scope *resolverScope) {
+  layout := NewFrameLayout()
+  for _, tok := range node.ArgNameToks {
+    layout.Add(tok.value.(string))
+  }
+  forEachDeclaration(node.BodyNode, func(_ string, tok Token, _ *FuncDefNode) {
+    layout.Add(tok.value.(string))
+  })
+  node.Layout = layout
+  // A generator's body runs on its own, what it returns is not its result.
+  node.Generator = yields(node.BodyNode)
+  if !node.Generator {
+    markTailCalls(node.BodyNode)
+  }
+  resolveNode(node.BodyNode, &resolverScope{parent: scope, layout: layout})
+}
+
+// markTailCalls flags the calls whose value becomes the value of the function:
+// returned ones and the last expression of the body, through if branches.
+func markTailCalls(body Node) {
+  Inspect(body, func(node Node) bool {
+    if ret, ok := node.(*ReturnNode); ok {
+      markTail(ret.NodeToReturn)
+    }
+    _, isFunc := node.(*FuncDefNode)
+    return !isFunc
+  })
+  markTail(body)
+}
+
+func markTail(node Node) {
+  switch n := node.(type) {
+    case *CallNode:
+      n.Tail = true
+    case *StatementsNode:
+      if len(n.Statements) > 0 {
+        markTail(n.Statements[len(n.Statements)-1])
+      }
+    case *IfNode:
+      for _, Case := range n.Cases {
+        markTail(Case[1])
+      }
+      markTail(n.ElseCase)
+  }
+}
+
+func resolveNode(node Node, scope *resolverScope) {
+  Inspect(node, func(n Node) bool {
+    switch n := n.(type) {
+      case *VarAccessNode:
+        n.Binding = scope.lookup(n.VarName.value.(string))
+      case *VarAssignNode:
+        if n.IsUpdate {
+          n.Binding = scope.lookup(n.VarName.value.(string))
+        } else {
+          n.Binding = scope.local(n.VarName.value.(string))
+        }
+      case *ForNode:
+        n.Binding = scope.local(n.VarNameTok.value.(string))
+        n.Layout = nil
+        if !definesFunction(n.BodyNode) {
+          return true
+        }
+        n.Layout = NewFrameLayout()
+        n.Layout.Add(n.VarNameTok.value.(string))
+        for _, child := range []Node{n.Iterable, n.StartVal, n.EndVal, n.StepVal} {
+          if child != nil {
+            resolveNode(child, scope)
+          }
+        }
+        resolveNode(n.BodyNode, &resolverScope{parent: scope, layout: n.Layout, iteration: true})
+        return false
+      case *FuncDefNode:
+        resolveFunction(n, scope)
+        return false
+    }
+    return true
+  })
+}
+
+// yields reports whether the body has a yield of its own, outside of the
+// functions defined in it.
+func yields(body Node) bool {
+  found := false
+  Inspect(body, func(node Node) bool {
+    if _, ok := node.(*YieldNode); ok {
+      found = true
+    }
+    _, isFunc := node.(*FuncDefNode)
+    return !found && !isFunc
+  })
+  return found
+}
+
+func definesFunction(node Node) bool {
+  found := false
+  Inspect(node, func(child Node) bool {
+    if _, ok := child.(*FuncDefNode); ok {
+      found = true
+    }
+    return !found
+  })
+  return found
+}
@@ -1,6 +1,399 @@
 package lang
 
+import (
+	"bufio"
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// Options select how a program is run.
+type Options struct {
+	// VM compiles the program to bytecode and runs it on the stack VM instead
+	// of walking the tree. Imported modules are still interpreted.
+	VM bool
+	// MaxDepth limits how deeply calls may nest, DefaultMaxDepth when zero.
+	// Tail calls do not count, they reuse the frame of their caller.
+	MaxDepth int
+	// MaxTailCalls limits how many frames tail calls replace in a row, which
+	// bounds tail recursion such as fn f(x) { f(x) }. DefaultMaxTailCalls
+	// when zero.
+	MaxTailCalls int
+	// MaxSteps limits the loop iterations and calls of the run, Timeout its
+	// wall-clock time. Both are unlimited when zero.
+	MaxSteps int
+	Timeout  time.Duration
+	// MaxMemory limits the bytes of the values the run holds, unlimited when
+	// zero. Values are held by variables, fields, the entries of collections
+	// and channel buffers, they are given back when they are replaced or
+	// their function returns. A value being created has to fit on top of
+	// what is held.
+	MaxMemory int
+	// Stats, when set, receives what the run used once it returns.
+	Stats *Stats
+	// Hooks, when set, are called as the run is evaluated.
+	Hooks *Hooks
+	// Stdout is where print and clear write, Stdin where input reads lines
+	// from, os.Stdout and os.Stdin when nil. A Stdin that is a *bufio.Reader
+	// is read from directly, so runs given the same one share what it has
+	// buffered.
+	Stdout io.Writer
+	Stdin  io.Reader
+	// Modules caches the modules the run imports. Runs given the same cache
+	// share them, such as the lines of a REPL, each run has its own when nil.
+	Modules *ModuleCache
+	// Importer gives the file of the module path imported from the file
+	// importer, or an error that refuses the import. Paths are taken relative
+	// to the importer when it is nil, see ImportsFrom to keep them to a
+	// directory.
+	Importer func(importer, path string) (string, error)
+}
+
+type Stats struct {
+	Steps int
+	// Memory is the most memory the run held at once, as MaxMemory counts
+	// it.
+	Memory int
+}
+
+const (
+	DefaultMaxDepth     = 1000
+	DefaultMaxTailCalls = 1000000
+)
+
+// runState is what the contexts of one run share, including the tasks it
+// spawns.
+type runState struct {
+	options  Options
+	ctx      gocontext.Context
+	cancel   gocontext.CancelFunc
+	deadline time.Time
+	limited  bool
+	// Set once the run spawns a task, whose steps must then notice finish
+	// even when nothing else limits the run.
+	spawned  atomic.Bool
+	steps    atomic.Int64
+	// Whether values are being accounted for, the bytes held and the most
+	// held at once.
+	accounting bool
+	memory     atomic.Int64
+	peak       atomic.Int64
+	modules    *ModuleCache
+	stdin      *bufio.Reader
+}
+
+func newRunState(ctx gocontext.Context, options Options) *runState {
+	r := &runState{options: options, ctx: ctx, modules: options.Modules}
+	if r.modules == nil {
+		r.modules = NewModuleCache()
+	}
+	// The run can always be cancelled, so that finish stops its tasks.
+	if options.Timeout > 0 {
+		r.deadline = time.Now().Add(options.Timeout)
+		r.ctx, r.cancel = gocontext.WithDeadline(ctx, r.deadline)
+	} else {
+		r.ctx, r.cancel = gocontext.WithCancel(ctx)
+	}
+	r.limited = options.MaxSteps > 0 || options.Timeout > 0 || ctx.Done() != nil || options.Stats != nil
+	r.accounting = options.MaxMemory > 0 || options.Stats != nil
+	switch in := options.Stdin.(type) {
+	case nil:
+		r.stdin = stdin
+	case *bufio.Reader:
+		r.stdin = in
+	default:
+		r.stdin = bufio.NewReader(in)
+	}
+	return r
+}
+
+// stdout is where the run prints.
+func (r *runState) stdout() io.Writer {
+	if r == nil || r.options.Stdout == nil {
+		return os.Stdout
+	}
+	return r.options.Stdout
+}
+
+// reader is where the run reads input from.
+func (r *runState) reader() *bufio.Reader {
+	if r == nil {
+		return stdin
+	}
+	return r.stdin
+}
+
+// finish cancels a run once it has returned, which releases the timer of a
+// timeout. Tasks it spawned that are still running are interrupted.
+func (r *runState) finish() {
+	r.cancel()
+}
+
+// stats is what the run has used so far.
+func (r *runState) stats() Stats {
+	return Stats{Steps: int(r.steps.Load()), Memory: int(r.peak.Load())}
+}
+
+// done is closed when the run is cancelled or out of time, operations that
+// block select on it.
+func (r *runState) done() <-chan struct{} {
+	if r == nil {
+		return nil
+	}
+	return r.ctx.Done()
+}
+
+// interrupted is the error for a run whose done channel is closed.
+func (r *runState) interrupted(posStart, posEnd Position, context Context) *Error {
+	if !r.deadline.IsZero() && !time.Now().Before(r.deadline) {
+		return InterruptError(posStart, posEnd, fmt.Sprintf("timeout of %v exceeded", r.options.Timeout), context)
+	}
+	return InterruptError(posStart, posEnd, r.ctx.Err().Error(), context)
+}
+
+// step counts a loop iteration or a call and stops the run once it is over
+// budget or cancelled. The context is only looked at every so many steps,
+// or at every step of runs with hooks, which are slow anyway and may need to
+// stop right away when a debugger quits.
+func (r *runState) step(posStart, posEnd Position, context Context) *Error {
+	if r == nil || (!r.limited && !r.spawned.Load()) {
+		return nil
+	}
+	steps := r.steps.Add(1)
+	if r.options.MaxSteps > 0 && steps > int64(r.options.MaxSteps) {
+		return InterruptError(posStart, posEnd, fmt.Sprintf("step limit of %v exceeded", r.options.MaxSteps), context)
+	}
+	if steps%256 != 0 && r.options.Hooks == nil {
+		return nil
+	}
+	select {
+	case <-r.ctx.Done():
+		return r.interrupted(posStart, posEnd, context)
+	default:
+		return nil
+	}
+}
+
 func Run(fn string, text string, globalSymbolTable *SymbolTable) (any, *Error) {
+	return RunWithOptions(fn, text, globalSymbolTable, Options{})
+}
+
+func RunWithOptions(fn string, text string, globalSymbolTable *SymbolTable, options Options) (any, *Error) {
+	return RunContext(gocontext.Background(), fn, text, globalSymbolTable, options)
+}
+
+// charge checks that a value the script creates fits on top of what the run
+// holds and stops the run when it does not.
+func (r *runState) charge(value Val, posStart, posEnd Position, context Context) *Error {
+	if r == nil || !r.accounting {
+		return nil
+	}
+	return r.use(r.memory.Load()+int64(sizeOf(value)), posStart, posEnd, context)
+}
+
+// retain accounts for a value stored where the script keeps it, release for
+// one that is no longer kept there.
+func (r *runState) retain(value Val, posStart, posEnd Position, context Context) *Error {
+	if r == nil || !r.accounting {
+		return nil
+	}
+	r.hold(value)
+	if err := r.use(r.memory.Load(), posStart, posEnd, context); err != nil {
+		r.drop(value)
+		return err
+	}
+	return nil
+}
+
+func (r *runState) release(value Val) {
+	if r == nil || !r.accounting {
+		return
+	}
+	r.drop(value)
+}
+
+// store accounts for replacing old with value in a variable, or in c when
+// it is set. What is stored in a container nothing keeps is only charged,
+// it is accounted for once the container is kept.
+func (r *runState) store(c container, old, value Val, posStart, posEnd Position, context Context) *Error {
+	if r == nil || !r.accounting {
+		return nil
+	}
+	if c != nil && !c.holds().kept(r) {
+		return r.charge(value, posStart, posEnd, context)
+	}
+	if err := r.retain(value, posStart, posEnd, context); err != nil {
+		return err
+	}
+	r.release(old)
+	return nil
+}
+
+// grow accounts for the bytes of a slot added to a container.
+func (r *runState) grow(c container, size int, posStart, posEnd Position, context Context) *Error {
+	if r == nil || !r.accounting || !c.holds().kept(r) {
+		return nil
+	}
+	if err := r.use(r.memory.Add(int64(size)), posStart, posEnd, context); err != nil {
+		r.memory.Add(-int64(size))
+		return err
+	}
+	return nil
+}
+
+// hold adds the bytes of a value, and those of what it contains when it is a
+// container nothing kept before. drop takes them away again.
+func (r *runState) hold(value Val) {
+	r.memory.Add(int64(sizeOf(value)))
+	if c, ok := value.(container); ok && c.holds().add(r, 1) == 1 {
+		values, size := c.contents()
+		r.memory.Add(int64(size))
+		for _, value := range values {
+			r.hold(value)
+		}
+	}
+}
+
+func (r *runState) drop(value Val) {
+	r.memory.Add(-int64(sizeOf(value)))
+	if c, ok := value.(container); ok && c.holds().add(r, -1) == 0 {
+		values, size := c.contents()
+		r.memory.Add(-int64(size))
+		for _, value := range values {
+			r.drop(value)
+		}
+	}
+}
+
+// use records that memory bytes are in use and stops the run when that is
+// over the budget.
+func (r *runState) use(memory int64, posStart, posEnd Position, context Context) *Error {
+	if r.options.MaxMemory > 0 && memory > int64(r.options.MaxMemory) {
+		return InterruptError(posStart, posEnd, fmt.Sprintf("memory limit exceeded (%v bytes)", r.options.MaxMemory), context)
+	}
+	for peak := r.peak.Load(); memory > peak; peak = r.peak.Load() {
+		if r.peak.CompareAndSwap(peak, memory) {
+			break
+		}
+	}
+	return nil
+}
+
+// releaseFrame gives back the values kept by the frame of a call that
+// returned, unless a function defined in it may still use them.
+func (r *runState) releaseFrame(frame *SymbolTable) {
+	if r == nil || !r.accounting || frame.captured.Load() {
+		return
+	}
+	for _, value := range frame.values() {
+		r.drop(value)
+	}
+}
+
+// holdGlobals accounts for what earlier runs left in the globals a run
+// starts with, built-ins aside.
+func (r *runState) holdGlobals(globals *SymbolTable) {
+	if !r.accounting {
+		return
+	}
+	for _, name := range globals.Names() {
+		if symbol := globals.Lookup(name); symbol != nil && (!symbol.Const || symbol.DeclPos != nil) {
+			r.hold(symbol.Value)
+		}
+	}
+	r.peak.Store(r.memory.Load())
+}
+
+// A container keeps the values in it for as long as it is kept itself, by a
+// variable, a field or another container.
+type container interface {
+	holds() *holds
+	// contents gives the values in the container and the bytes of the slots
+	// they take up.
+	contents() ([]Val, int)
+}
+
+// holds counts the places a run keeps a container in.
+type holds struct {
+	mu    sync.Mutex
+	run   *runState
+	count int
+}
+
+// add changes the count for run and returns it. Counts left by another run,
+// such as an earlier line of a REPL, start over.
+func (h *holds) add(run *runState, delta int) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.run != run {
+		h.run, h.count = run, 0
+	}
+	h.count += delta
+	return h.count
+}
+
+func (h *holds) kept(run *runState) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.run == run && h.count > 0
+}
+
+// slotSize is what a list element or a field takes up besides its value.
+const slotSize = int(unsafe.Sizeof(Val(nil)))
+
+func entrySize(key string) int {
+	return len(key) + int(unsafe.Sizeof(key)) + slotSize
+}
+
+// sizeOf estimates the bytes a value takes up, without what it contains.
+func sizeOf(value Val) int {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case *StringVal:
+		return int(unsafe.Sizeof(*v)) + len(v.value)
+	case *Number:
+		return int(unsafe.Sizeof(*v))
+	}
+	return int(unsafe.Sizeof(Value{}))
+}
+
+// RunContext is RunWithOptions that also stops when ctx is done. Running out
+// of steps or time and cancellation return an error for which Interrupted
+// reports true.
+func RunContext(ctx gocontext.Context, fn string, text string, globalSymbolTable *SymbolTable, options Options) (any, *Error) {
+	context := Context{
+		DisplayName: "<program>",
+		SymbolTable: globalSymbolTable,
+		run:         newRunState(ctx, options),
+	}
+	defer context.run.finish()
+	context.run.holdGlobals(globalSymbolTable)
+	path := context.run.modules.enter(fn)
+	result, err := execute(fn, text, context, options)
+	if path != "" {
+		context.run.modules.loaded(path, NewModule(moduleName(path), path, globalSymbolTable), err)
+	}
+	if options.Stats != nil {
+		*options.Stats = context.run.stats()
+	}
+	return result, err
+}
+
+func RunAST(node Node, globalSymbolTable *SymbolTable) (any, *Error) {
+	context := Context{
+		DisplayName: "<program>",
+		SymbolTable: globalSymbolTable,
+	}
+	return interpret(node, context, Options{})
+}
+
+func Parse(fn string, text string) (Node, *Error) {
 	lexer := NewLexer(fn, text)
 	tokens, err := lexer.MakeTokens()
 	if err != nil {
@@ -12,13 +405,28 @@ func Run(fn string, text string, globalSymbolTable *SymbolTable) (any, *Error) {
 	if ast.error != nil {
 		return nil, ast.error
 	}
+	return ast.node, nil
+}
 
-	interpreter := &Interpreter{}
-	context := Context{
-		DisplayName: "<program>",
-		SymbolTable: globalSymbolTable,
+func execute(fn string, text string, context Context, options Options) (any, *Error) {
+	node, err := Parse(fn, text)
+	if err != nil {
+		return nil, err
 	}
-	result := interpreter.Visit(ast.node, context)
-	return result.value, result.error
+	return interpret(Optimize(node), context, options)
 }
 
+func interpret(node Node, context Context, options Options) (any, *Error) {
+	Resolve(node)
+	var result RTResult
+	if options.VM && options.Hooks == nil {
+		result = Compile(node).Main.Run(context)
+	} else {
+		interpreter := &Interpreter{}
+		result = interpreter.Visit(node, context)
+	}
+	if result.shouldReturn {
+		return result.funcReturnValue, result.error
+	}
+	return result.value, result.error
+}
@@ -0,0 +1,77 @@
+package lang
+
+import (
+	gocontext "context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFinishedRunStopsTasks(t *testing.T) {
+  for _, timeout := range []time.Duration{0, time.Minute} {
+    for _, vm := range []bool{false, true} {
+      var ticks atomic.Int64
+      engine := NewEngine()
+      engine.Options = Options{VM: vm, Timeout: timeout}
+      if err := engine.Register("tick", func() int64 { return ticks.Add(1) }); err != nil {
+        t.Fatal(err)
+      }
+      _, err := engine.Run("<test>", "fn loop() { while 1 { tick() } }\nvar t = spawn loop()\nwhile tick() < 1000 {}\n")
+      if err != nil {
+        t.Fatal(err)
+      }
+
+      // The task may take a few steps to notice.
+      time.Sleep(10 * time.Millisecond)
+      stopped := ticks.Load()
+      time.Sleep(20 * time.Millisecond)
+      if ticks.Load() != stopped {
+        t.Errorf("timeout %v, vm %v: the task kept running after its run returned", timeout, vm)
+      }
+    }
+  }
+}
+
+func TestInterrupts(t *testing.T) {
+  cancelled, cancel := gocontext.WithCancel(gocontext.Background())
+  cancel()
+  tests := []struct {
+    ctx gocontext.Context
+    options Options
+    want string
+  }{
+    {gocontext.Background(), Options{MaxSteps: 1000}, "step limit of 1000 exceeded"},
+    {gocontext.Background(), Options{Timeout: 20 * time.Millisecond}, "timeout of 20ms exceeded"},
+    {cancelled, Options{}, "context canceled"},
+  }
+  for _, test := range tests {
+    for _, vm := range []bool{false, true} {
+      test.options.VM = vm
+      _, err := RunContext(test.ctx, "<test>", "fn f() { 1 }\nwhile 1 { f() }", NewGlobals(), test.options)
+      if err == nil || !err.Interrupted() || !strings.Contains(err.Error(), test.want) {
+        t.Errorf("%+v: got %v, want %v", test.options, err, test.want)
+      }
+    }
+  }
+}
+
+// Run with -race, tasks must not write to the values they share.
+func TestTasksShareValues(t *testing.T) {
+  text := "fn use(x) { x + \"\" }\nfn each() { for x in items { use(x) } }\nfn make() { \"result\" }\nvar r = spawn make()\nfn wait() { use(await r) }\n" +
+    "var a = spawn each()\nvar b = spawn each()\nvar c = spawn wait()\nvar d = spawn wait()\nawait a; await b; await c; await d\nawait r"
+  for _, vm := range []bool{false, true} {
+    engine := NewEngine()
+    engine.Options.VM = vm
+    if err := engine.Set("items", []any{"a", "b", "c"}); err != nil {
+      t.Fatal(err)
+    }
+    result, err := engine.Run("<test>", text)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if result != "result" {
+      t.Errorf("vm %v: got %v", vm, result)
+    }
+  }
+}
@@ -1,29 +1,251 @@
 package lang
 
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// A Symbol is never changed once it is in a table, assigning replaces it.
+type Symbol struct {
+	Value   Val
+	Const   bool
+	DeclPos *Position
+}
+
+// SymbolTable is safe for use by concurrent tasks.
 type SymbolTable struct {
-	Symbols map[string]Val
+  mu sync.RWMutex
+	Symbols map[string]*Symbol
 	Parent  *SymbolTable
+  // Function frames keep their locals in Slots, in the order given by
+  // Layout. Names outside the layout, such as the hidden "super", still go
+  // to Symbols.
+  Layout *FrameLayout
+  Slots []*Symbol
+  // Iteration frames hold the variable of one loop iteration, names declared
+  // in the loop body go to the enclosing table.
+  Iteration bool
+  // Whether a function was defined in the table or below it, which may keep
+  // using its values after the call that made it returns.
+  captured atomic.Bool
+  // How often the instance whose fields the table holds is kept.
+  holds holds
+}
+
+// FrameLayout lists the local names of a function in slot order, parameters
+// first. It is computed once per function by Resolve.
+type FrameLayout struct {
+  Names []string
+  Index map[string]int
+}
+
+func NewFrameLayout() *FrameLayout {
+  return &FrameLayout{Index: make(map[string]int)}
+}
+
+func (fl *FrameLayout) Add(name string) int {
+  if slot, ok := fl.Index[name]; ok {
+    return slot
+  }
+  fl.Index[name] = len(fl.Names)
+  fl.Names = append(fl.Names, name)
+  return len(fl.Names) - 1
 }
 
 func NewSymbolTable(parent *SymbolTable) *SymbolTable {
 	return &SymbolTable{
-		Symbols: make(map[string]Val),
+		Symbols: make(map[string]*Symbol),
     Parent: parent,
 	}
 }
 
+func NewFrame(parent *SymbolTable, layout *FrameLayout) *SymbolTable {
+  if layout == nil {
+    return NewSymbolTable(parent)
+  }
+  return &SymbolTable{Parent: parent, Layout: layout, Slots: make([]*Symbol, len(layout.Names))}
+}
+
+func NewIterationFrame(parent *SymbolTable, layout *FrameLayout) *SymbolTable {
+  frame := NewFrame(parent, layout)
+  frame.Iteration = true
+  return frame
+}
+
+func NewGlobals() *SymbolTable {
+  globals := NewSymbolTable(nil)
+  globals.SetConst("null", NewNumber(0), nil)
+  globals.SetConst("true", NewNumber(1), nil)
+  globals.SetConst("false", NewNumber(0), nil)
+  builtins := []*BuiltinFunction{
+    NewBuiltinFunction("print", []string{"value"}, builtinPrint),
+    NewBuiltinFunction("input", []string{"prompt"}, builtinInput),
+    NewBuiltinFunction("len", []string{"value"}, builtinLen),
+    NewBuiltinFunction("type", []string{"value"}, builtinType),
+    NewBuiltinFunction("str", []string{"value"}, builtinStr),
+    NewBuiltinFunction("int", []string{"value"}, builtinInt),
+    NewBuiltinFunction("float", []string{"value"}, builtinFloat),
+    NewBuiltinFunction("is_number", []string{"value"}, builtinIsNumber),
+    NewBuiltinFunction("is_string", []string{"value"}, builtinIsString),
+    NewBuiltinFunction("is_function", []string{"value"}, builtinIsFunction),
+    NewBuiltinFunction("clear", []string{}, builtinClear),
+    NewBuiltinFunction("exit", []string{}, builtinExit),
+    NewBuiltinFunction("channel", []string{"size"}, builtinChannel),
+  }
+  for _, builtin := range builtins {
+    globals.SetConst(builtin.Name, builtin, nil)
+  }
+  return globals
+}
+
+func (st *SymbolTable) slot(name string) int {
+  if st.Layout == nil {
+    return -1
+  }
+  if slot, ok := st.Layout.Index[name]; ok {
+    return slot
+  }
+  return -1
+}
+
 func (st *SymbolTable) Get(name string) Val {
-	value, ok := st.Symbols[name]
-	if !ok && st.Parent != nil {
-		return st.Parent.Get(name)
+	symbol := st.Lookup(name)
+	if symbol == nil {
+		if st.Parent != nil {
+			return st.Parent.Get(name)
+		}
+		return nil
 	}
-	return value
+	return symbol.Value
+}
+
+// Ancestor returns the table depth levels up the parent chain.
+func (st *SymbolTable) Ancestor(depth int) *SymbolTable {
+  table := st
+  for range depth {
+    table = table.Parent
+  }
+  return table
+}
+
+// GetSlot reads a variable resolved to a slot of the frame depth levels up.
+// A slot that has not been assigned yet falls back to the enclosing tables,
+// just like a lookup by name would.
+func (st *SymbolTable) GetSlot(depth, slot int, name string) Val {
+  table := st.Ancestor(depth)
+  if slot < 0 || slot >= len(table.Slots) {
+    return table.Get(name)
+  }
+  table.mu.RLock()
+  symbol := table.Slots[slot]
+  table.mu.RUnlock()
+  if symbol != nil {
+    return symbol.Value
+  }
+  if table.Parent != nil {
+    return table.Parent.Get(name)
+  }
+  return nil
+}
+
+func (st *SymbolTable) Lookup(name string) *Symbol {
+  st.mu.RLock()
+  defer st.mu.RUnlock()
+  if slot := st.slot(name); slot >= 0 {
+    return st.Slots[slot]
+  }
+  return st.Symbols[name]
+}
+
+func (st *SymbolTable) LookupSlot(slot int, name string) *Symbol {
+  if slot < 0 || slot >= len(st.Slots) {
+    return st.Lookup(name)
+  }
+  st.mu.RLock()
+  defer st.mu.RUnlock()
+  return st.Slots[slot]
 }
 
 func (st *SymbolTable) Set(name string, value Val) {
-	st.Symbols[name] = value
+  st.SetSlot(st.slot(name), name, value)
+}
+
+func (st *SymbolTable) SetSlot(slot int, name string, value Val) {
+  st.mu.Lock()
+  defer st.mu.Unlock()
+  if slot < 0 || slot >= len(st.Slots) {
+    if st.Symbols == nil {
+      st.Symbols = make(map[string]*Symbol)
+    }
+    st.Symbols[name] = &Symbol{Value: value}
+    return
+  }
+  st.Slots[slot] = &Symbol{Value: value}
+}
+
+func (st *SymbolTable) SetConst(name string, value Val, declPos *Position) {
+  st.mu.Lock()
+  defer st.mu.Unlock()
+  symbol := &Symbol{Value: value, Const: true, DeclPos: declPos}
+  if slot := st.slot(name); slot >= 0 {
+    st.Slots[slot] = symbol
+    return
+  }
+  if st.Symbols == nil {
+    st.Symbols = make(map[string]*Symbol)
+  }
+	st.Symbols[name] = symbol
 }
 
 func (st *SymbolTable) Remove(name string) {
+  st.mu.Lock()
+  defer st.mu.Unlock()
+  if slot := st.slot(name); slot >= 0 {
+    st.Slots[slot] = nil
+    return
+  }
   delete(st.Symbols, name)
 }
+
+// Names returns the names assigned in the table itself, not its parents,
+// in slot order followed by the other names sorted.
+func (st *SymbolTable) Names() []string {
+  st.mu.RLock()
+  defer st.mu.RUnlock()
+  names := []string{}
+  for slot, symbol := range st.Slots {
+    if symbol != nil {
+      names = append(names, st.Layout.Names[slot])
+    }
+  }
+  others := []string{}
+  for name := range st.Symbols {
+    others = append(others, name)
+  }
+  sort.Strings(others)
+  return append(names, others...)
+}
+
+// values returns the values assigned in the table itself.
+func (st *SymbolTable) values() []Val {
+  st.mu.RLock()
+  defer st.mu.RUnlock()
+  values := []Val{}
+  for _, symbol := range st.Slots {
+    if symbol != nil {
+      values = append(values, symbol.Value)
+    }
+  }
+  for _, symbol := range st.Symbols {
+    values = append(values, symbol.Value)
+  }
+  return values
+}
+
+// capture marks the table and the ones enclosing it as captured.
+func (st *SymbolTable) capture() {
+  for table := st; table != nil && !table.captured.Load(); table = table.Parent {
+    table.captured.Store(true)
+  }
+}
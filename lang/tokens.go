@@ -40,3 +40,35 @@ func (t Token) String() string {
 func (t Token) Matches(type_, value string) bool {
   return t.type_ == type_ && t.value == value
 }
+
+var tokenSymbols = map[string]string{
+  PLUS: "+",
+  MINUS: "-",
+  MUL: "*",
+  DIV: "/",
+  POW: "**",
+  EQ: "=",
+  EE: "==",
+  NE: "!=",
+  LT: "<",
+  GT: ">",
+  LTE: "<=",
+  GTE: ">=",
+  LPAREN: "(",
+  RPAREN: ")",
+  LSQUARE: "[",
+  RSQUARE: "]",
+  LBRACE: "{",
+  RBRACE: "}",
+  ARROW: "->",
+  COMMA: ",",
+  COLON: ":",
+  DOT: ".",
+}
+
+func (t Token) Symbol() string {
+  if symbol, ok := tokenSymbols[t.type_]; ok {
+    return symbol
+  }
+  return fmt.Sprintf("%v", t.value)
+}
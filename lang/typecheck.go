@@ -0,0 +1,502 @@
+package lang
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+  RuleTypeMismatch = "type-mismatch"
+  RuleUnknownType = "unknown-type"
+)
+
+const (
+  TypeInt = "int"
+  TypeFloat = "float"
+  TypeNum = "num"
+  TypeStr = "str"
+  TypeFn = "fn"
+  TypeAny = "any"
+)
+
+// Check infers the types of expressions and reports operations that the
+// runtime values would reject, such as subtracting from a string, as well as
+// values that do not match their annotations. Annotations are only read here;
+// the interpreter ignores them. Declared class names can be used as types.
+func Check(node Node, builtins *SymbolTable) []Diagnostic {
+  c := &typeChecker{builtins: builtins, classes: make(map[string]bool)}
+  Inspect(node, func(n Node) bool {
+    if cdn, ok := n.(*ClassDefNode); ok {
+      c.classes[cdn.ClassNameTok.value.(string)] = true
+    }
+    return true
+  })
+
+  global := newTypeScope(nil, "")
+  c.collect(global, node)
+  c.infer(node, global)
+
+  sort.SliceStable(c.diagnostics, func(a, b int) bool {
+    return c.diagnostics[a].PosStart.idx < c.diagnostics[b].PosStart.idx
+  })
+  return c.diagnostics
+}
+
+type typeVar struct {
+  typ string
+  declared bool
+  fn *FuncDefNode
+  class string
+}
+
+type typeScope struct {
+  parent *typeScope
+  vars map[string]*typeVar
+  returnType string
+}
+
+func newTypeScope(parent *typeScope, returnType string) *typeScope {
+  return &typeScope{parent: parent, vars: make(map[string]*typeVar), returnType: returnType}
+}
+
+func (s *typeScope) resolve(name string) *typeVar {
+  for scope := s; scope != nil; scope = scope.parent {
+    if v, ok := scope.vars[name]; ok {
+      return v
+    }
+  }
+  return nil
+}
+
+type typeChecker struct {
+  builtins *SymbolTable
+  classes map[string]bool
+  diagnostics []Diagnostic
+}
+
+func (c *typeChecker) report(rule string, posStart, posEnd Position, format string, args ...any) {
+  c.diagnostics = append(c.diagnostics, Diagnostic{rule, fmt.Sprintf(format, args...), posStart, posEnd})
+}
+
+func isNumeric(typ string) bool {
+  return typ == TypeInt || typ == TypeFloat || typ == TypeNum
+}
+
+func joinTypes(a, b string) string {
+  if a == b {
+    return a
+  }
+  if isNumeric(a) && isNumeric(b) {
+    return TypeNum
+  }
+  return TypeAny
+}
+
+func assignable(from, to string) bool {
+  if from == to || from == TypeAny || to == TypeAny {
+    return true
+  }
+  // A num may hold either kind of number, and ints are accepted where a float
+  // is expected since Number operations work on both.
+  if isNumeric(from) && isNumeric(to) {
+    return from == TypeNum || to == TypeNum || from == TypeInt
+  }
+  return false
+}
+
+func typeOfVal(value Val) string {
+  switch v := value.(type) {
+    case *Number:
+      if _, ok := v.value.(float64); ok {
+        return TypeFloat
+      }
+      return TypeInt
+    case *StringVal:
+      return TypeStr
+    case *Instance:
+      return v.Class.Name
+    case Callable:
+      return TypeFn
+  }
+  return TypeAny
+}
+
+func (c *typeChecker) typeName(tok Token) string {
+  name, _ := tok.value.(string)
+  switch name {
+    case "":
+      return TypeAny
+    case TypeInt, TypeFloat, TypeNum, TypeStr, TypeFn, TypeAny:
+      return name
+  }
+  if c.classes[name] {
+    return name
+  }
+  c.report(RuleUnknownType, tok.PosStart, tok.PosEnd, "unknown type '%v'", name)
+  return TypeAny
+}
+
+// collect declares the functions and classes of a scope up front, since they
+// may be called before their definition has been reached.
+func (c *typeChecker) collect(scope *typeScope, body Node) {
+  Inspect(body, func(node Node) bool {
+    switch n := node.(type) {
+      case *FuncDefNode:
+        if name, _ := n.VarNameTok.value.(string); name != "" {
+          scope.vars[name] = &typeVar{typ: TypeFn, fn: n}
+        }
+        return false
+      case *ClassDefNode:
+        name := n.ClassNameTok.value.(string)
+        scope.vars[name] = &typeVar{typ: TypeFn, class: name}
+    }
+    return true
+  })
+}
+
+func (c *typeChecker) assign(scope *typeScope, name string, typ string, posStart, posEnd Position) {
+  v, ok := scope.vars[name]
+  if !ok {
+    scope.vars[name] = &typeVar{typ: typ}
+    return
+  }
+  if v.declared {
+    if !assignable(typ, v.typ) {
+      c.report(RuleTypeMismatch, posStart, posEnd, "cannot assign %v to '%v' (declared %v)", typ, name, v.typ)
+    }
+    return
+  }
+  v.typ = joinTypes(v.typ, typ)
+  v.fn, v.class = nil, ""
+}
+
+func (c *typeChecker) infer(node Node, scope *typeScope) string {
+  switch n := node.(type) {
+    case *NumberNode:
+      if _, ok := n.Tok.value.(float64); ok {
+        return TypeFloat
+      }
+      return TypeInt
+    case *StringNode:
+      return TypeStr
+    case *VarAccessNode:
+      name := n.VarName.value.(string)
+      if v := scope.resolve(name); v != nil {
+        return v.typ
+      }
+      if c.builtins != nil {
+        if value := c.builtins.Get(name); value != nil {
+          return typeOfVal(value)
+        }
+      }
+      return TypeAny
+    case *VarAssignNode:
+      return c.varAssign(n, scope)
+    case *BinOpNode:
+      return c.binOp(n, scope)
+    case *UnaryOpNode:
+      typ := c.infer(n.Node, scope)
+      if typ == TypeAny || n.OpTok.type_ == PLUS {
+        return typ
+      }
+      if n.OpTok.Matches(KEYWORD, "not") {
+        if isNumeric(typ) {
+          return TypeInt
+        }
+      } else if isNumeric(typ) {
+        return typ
+      }
+      c.report(RuleTypeMismatch, n.PosStart, n.PosEnd, "unsupported operand type for '%v': %v", n.OpTok.Symbol(), typ)
+      return TypeAny
+    case *IfNode:
+      for _, Case := range n.Cases {
+        c.infer(Case[0], scope)
+        c.infer(Case[1], scope)
+      }
+      if n.ElseCase != nil {
+        c.infer(n.ElseCase, scope)
+      }
+      return TypeAny
+    case *ForNode:
+      if n.Iterable != nil {
+        c.infer(n.Iterable, scope)
+        c.assign(scope, n.VarNameTok.value.(string), TypeAny, n.VarNameTok.PosStart, n.VarNameTok.PosEnd)
+        c.infer(n.BodyNode, scope)
+        return TypeAny
+      }
+      loopType := TypeInt
+      for _, bound := range []Node{n.StartVal, n.EndVal, n.StepVal} {
+        if bound == nil {
+          continue
+        }
+        typ := c.infer(bound, scope)
+        if !assignable(typ, TypeNum) {
+          c.report(RuleTypeMismatch, bound.GetPosStart(), bound.GetPosEnd(), "for loop bounds must be numbers, got %v", typ)
+        } else if bound != n.EndVal {
+          loopType = joinTypes(loopType, typ)
+        }
+      }
+      c.assign(scope, n.VarNameTok.value.(string), loopType, n.VarNameTok.PosStart, n.VarNameTok.PosEnd)
+      c.infer(n.BodyNode, scope)
+      return TypeAny
+    case *WhileNode:
+      c.infer(n.Cond, scope)
+      c.infer(n.BodyNode, scope)
+      return TypeAny
+    case *FuncDefNode:
+      c.function(n, scope)
+      return TypeFn
+    case *CallNode:
+      return c.call(n, scope)
+    case *StatementsNode:
+      typ := TypeAny
+      for _, statement := range n.Statements {
+        typ = c.infer(statement, scope)
+      }
+      return typ
+    case *ReturnNode:
+      typ := TypeInt
+      if n.NodeToReturn != nil {
+        typ = c.infer(n.NodeToReturn, scope)
+      }
+      if scope.returnType != "" && !assignable(typ, scope.returnType) {
+        c.report(RuleTypeMismatch, n.PosStart, n.PosEnd, "function must return %v, got %v", scope.returnType, typ)
+      }
+      return TypeAny
+    case *YieldNode:
+      c.infer(n.Node, scope)
+      return TypeAny
+    case *SpawnNode:
+      c.infer(n.Call, scope)
+      return TypeAny
+    case *AwaitNode:
+      c.infer(n.Node, scope)
+      return TypeAny
+    case *FieldAccessNode:
+      c.infer(n.NodeToAccess, scope)
+      return TypeAny
+    case *FieldAssignNode:
+      c.infer(n.NodeToAccess, scope)
+      return c.infer(n.ValueNode, scope)
+    case *ClassDefNode:
+      if n.ParentNode != nil {
+        c.infer(n.ParentNode, scope)
+      }
+      for _, valueNode := range n.FieldValueNodes {
+        if valueNode != nil {
+          c.infer(valueNode, scope)
+        }
+      }
+      for _, method := range n.MethodNodes {
+        c.function(method, scope)
+      }
+      name := n.ClassNameTok.value.(string)
+      scope.vars[name] = &typeVar{typ: TypeFn, class: name}
+      return TypeFn
+    case *SuperNode:
+      return TypeAny
+    case *ImportNode:
+      if alias, _ := n.AliasTok.value.(string); alias != "" {
+        c.assign(scope, alias, TypeAny, n.AliasTok.PosStart, n.AliasTok.PosEnd)
+      } else {
+        c.assign(scope, moduleName(n.PathTok.value.(string)), TypeAny, n.PathTok.PosStart, n.PathTok.PosEnd)
+      }
+      return TypeAny
+    case *FromImportNode:
+      for _, tok := range n.NameToks {
+        c.assign(scope, tok.value.(string), TypeAny, tok.PosStart, tok.PosEnd)
+      }
+      return TypeAny
+  }
+  panic(fmt.Sprintf("Check: unexpected node type %T", node))
+}
+
+func (c *typeChecker) varAssign(node *VarAssignNode, scope *typeScope) string {
+  name := node.VarName.value.(string)
+  typ := c.infer(node.ValueNode, scope)
+  if node.IsUpdate {
+    // The variable keeps the scope that declared it.
+    for outer := scope; outer != nil; outer = outer.parent {
+      if _, ok := outer.vars[name]; ok {
+        c.assign(outer, name, typ, node.ValueNode.GetPosStart(), node.ValueNode.GetPosEnd())
+        break
+      }
+    }
+    return typ
+  }
+
+  if annotation, _ := node.TypeTok.value.(string); annotation != "" {
+    declared := c.typeName(node.TypeTok)
+    if !assignable(typ, declared) {
+      c.report(
+        RuleTypeMismatch, node.ValueNode.GetPosStart(), node.ValueNode.GetPosEnd(),
+        "cannot assign %v to '%v' (declared %v)", typ, name, declared,
+      )
+    }
+    scope.vars[name] = &typeVar{typ: declared, declared: true}
+    return typ
+  }
+  c.assign(scope, name, typ, node.ValueNode.GetPosStart(), node.ValueNode.GetPosEnd())
+  return typ
+}
+
+func arithmeticType(left, right string) string {
+  if left == TypeInt && right == TypeInt {
+    return TypeInt
+  }
+  if left == TypeFloat || right == TypeFloat {
+    return TypeFloat
+  }
+  return TypeNum
+}
+
+// binaryType mirrors the operations implemented by Number and StringVal. It
+// returns "" for combinations the runtime rejects.
+func binaryType(op Token, left, right string) string {
+  numbers := isNumeric(left) && isNumeric(right)
+  switch op.type_ {
+    case PLUS:
+      if left == TypeStr && right == TypeStr {
+        return TypeStr
+      }
+      fallthrough
+    case MINUS, MUL:
+      if numbers {
+        return arithmeticType(left, right)
+      }
+    case DIV:
+      if numbers {
+        return TypeFloat
+      }
+      if left == TypeStr && (right == TypeInt || right == TypeNum) {
+        return TypeStr
+      }
+    case POW:
+      if numbers {
+        return TypeFloat
+      }
+    case EE, NE:
+      if numbers || left == TypeStr && right == TypeStr {
+        return TypeInt
+      }
+      // Only numbers and strings are known to reject each other.
+      if !isNumeric(left) && left != TypeStr || !isNumeric(right) && right != TypeStr {
+        return TypeInt
+      }
+    case LT, GT, LTE, GTE:
+      if numbers {
+        return TypeInt
+      }
+    case KEYWORD:
+      if numbers {
+        return TypeInt
+      }
+  }
+  return ""
+}
+
+func (c *typeChecker) binOp(node *BinOpNode, scope *typeScope) string {
+  left := c.infer(node.LeftNode, scope)
+  right := c.infer(node.RightNode, scope)
+  if left == TypeAny || right == TypeAny {
+    return TypeAny
+  }
+
+  typ := binaryType(node.OpTok, left, right)
+  if typ == "" {
+    c.report(
+      RuleTypeMismatch, node.PosStart, node.PosEnd,
+      "unsupported operand types for '%v': %v and %v", node.OpTok.Symbol(), left, right,
+    )
+    return TypeAny
+  }
+  return typ
+}
+
+func (c *typeChecker) function(node *FuncDefNode, scope *typeScope) {
+  fnScope := newTypeScope(scope, "")
+  if returnType, _ := node.ReturnTypeTok.value.(string); returnType != "" {
+    fnScope.returnType = c.typeName(node.ReturnTypeTok)
+  }
+  for idx, tok := range node.ArgNameToks {
+    typ := TypeAny
+    if idx < len(node.ArgTypeToks) {
+      typ = c.typeName(node.ArgTypeToks[idx])
+    }
+    fnScope.vars[tok.value.(string)] = &typeVar{typ: typ, declared: typ != TypeAny}
+  }
+
+  c.collect(fnScope, node.BodyNode)
+  typ := c.infer(node.BodyNode, fnScope)
+
+  // Without a return statement the body evaluates to its last statement.
+  body := node.BodyNode.(*StatementsNode)
+  if fnScope.returnType != "" && len(body.Statements) > 0 && !terminates(body) && !yields(body) {
+    last := body.Statements[len(body.Statements)-1]
+    if !assignable(typ, fnScope.returnType) {
+      c.report(RuleTypeMismatch, last.GetPosStart(), last.GetPosEnd(), "function must return %v, got %v", fnScope.returnType, typ)
+    }
+  }
+}
+
+func (c *typeChecker) call(node *CallNode, scope *typeScope) string {
+  callee := c.infer(node.NodeToCall, scope)
+  args := []string{}
+  for _, arg := range node.ArgNodes {
+    args = append(args, c.infer(arg, scope))
+  }
+
+  if isNumeric(callee) || callee == TypeStr || c.classes[callee] {
+    c.report(RuleTypeMismatch, node.PosStart, node.PosEnd, "%v is not callable", callee)
+    return TypeAny
+  }
+
+  access, ok := node.NodeToCall.(*VarAccessNode)
+  if !ok {
+    return TypeAny
+  }
+  name := access.VarName.value.(string)
+  v := scope.resolve(name)
+  if v == nil {
+    return TypeAny
+  }
+  if v.class != "" {
+    return v.class
+  }
+  if v.fn == nil {
+    return TypeAny
+  }
+
+  for idx, typ := range args {
+    if idx >= len(v.fn.ArgTypeToks) {
+      break
+    }
+    expected := c.typeNameQuiet(v.fn.ArgTypeToks[idx])
+    if !assignable(typ, expected) {
+      arg := node.ArgNodes[idx]
+      c.report(
+        RuleTypeMismatch, arg.GetPosStart(), arg.GetPosEnd(),
+        "argument %v of '%v' must be %v, got %v", idx+1, name, expected, typ,
+      )
+    }
+  }
+  if yields(v.fn.BodyNode) {
+    // The call returns a generator, not what the function returns.
+    return TypeAny
+  }
+  return c.typeNameQuiet(v.fn.ReturnTypeTok)
+}
+
+// typeNameQuiet resolves an annotation that has already been reported on
+// when its function was checked.
+func (c *typeChecker) typeNameQuiet(tok Token) string {
+  name, _ := tok.value.(string)
+  switch name {
+    case TypeInt, TypeFloat, TypeNum, TypeStr, TypeFn:
+      return name
+  }
+  if c.classes[name] {
+    return name
+  }
+  return TypeAny
+}
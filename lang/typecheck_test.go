@@ -0,0 +1,73 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+)
+
+func checkText(t *testing.T, text string) string {
+  t.Helper()
+  node, err := Parse("<test>", text)
+  if err != nil {
+    t.Fatal(err.AsString())
+  }
+  diagnostics := []string{}
+  for _, diagnostic := range Check(node, NewGlobals()) {
+    diagnostics = append(diagnostics, diagnostic.String())
+  }
+  return strings.Join(diagnostics, "\n")
+}
+
+func TestCheckReportsMismatches(t *testing.T) {
+  tests := []struct {
+    text string
+    want string
+  }{
+    {"\"a\" - 1", "<test>:1:1: unsupported operand types for '-': str and int [type-mismatch]"},
+    // The types of variables are followed, an operation that failed is not
+    // reported again further up.
+    {"var s = \"a\"\nvar n = 2\ns * n - 1", "<test>:3:1: unsupported operand types for '*': str and int [type-mismatch]"},
+    {"-\"a\"", "<test>:1:1: unsupported operand type for '-': str [type-mismatch]"},
+    {"var n: int = \"a\"", "<test>:1:14: cannot assign str to 'n' (declared int) [type-mismatch]"},
+    {"var n: int = 1\nvar n = 2.5", "<test>:2:9: cannot assign float to 'n' (declared int) [type-mismatch]"},
+    {"var n: int = 1\nn = \"a\"", "<test>:2:5: cannot assign str to 'n' (declared int) [type-mismatch]"},
+    {"fn f() { var n: str = \"a\"; fn g() { n = 1 } }", "<test>:1:41: cannot assign int to 'n' (declared str) [type-mismatch]"},
+    {"fn f(a: int) { a }\nf(\"x\")", "<test>:2:3: argument 1 of 'f' must be int, got str [type-mismatch]"},
+    {"fn f() -> str { 1 }", "<test>:1:17: function must return str, got int [type-mismatch]"},
+    {"fn f() -> int { return \"a\" }", "<test>:1:17: function must return int, got str [type-mismatch]"},
+    {"1(2)", "<test>:1:1: int is not callable [type-mismatch]"},
+    {"var n: nothing = 1", "<test>:1:8: unknown type 'nothing' [unknown-type]"},
+    {"for i = \"a\" in 3 {}", "<test>:1:9: for loop bounds must be numbers, got str [type-mismatch]"},
+    {"class P { x }\nvar p: P = 1", "<test>:2:12: cannot assign int to 'p' (declared P) [type-mismatch]"},
+    // Every mismatch is reported, in the order of the source.
+    {"var a: int = \"x\"\n\"b\" - 1", "<test>:1:14: cannot assign str to 'a' (declared int) [type-mismatch]\n<test>:2:1: unsupported operand types for '-': str and int [type-mismatch]"},
+  }
+  for _, test := range tests {
+    if got := checkText(t, test.text); got != test.want {
+      t.Errorf("%q:\ngot  %v\nwant %v", test.text, got, test.want)
+    }
+  }
+}
+
+func TestCheckAccepts(t *testing.T) {
+  tests := []string{
+    "1 + 2.5",
+    "\"a\" + \"b\"",
+    "var f: float = 1",
+    "var n: num = 1\nvar n = 2.5",
+    "var n = 1\nvar n = \"a\"",
+    "fn f(a: int, b) -> int { a + b }\nf(1, \"x\")",
+    "fn f(x) { x - 1 }\nf(\"a\")",
+    "fn f() -> str { if 1 { return \"a\" }; return \"b\" }",
+    "fn gen() -> int { yield \"a\" }",
+    "class P { x }\nvar p: P = P(1)\np.x - 1",
+    "fn later() { early() }\nfn early() { 1 }",
+    "var n = 1\nfn inc() { n = n + 1 }",
+    "len(\"abc\") + 1",
+  }
+  for _, text := range tests {
+    if got := checkText(t, text); got != "" {
+      t.Errorf("%q: %v", text, got)
+    }
+  }
+}
@@ -1,8 +1,13 @@
 package lang
 
 import (
+	gocontext "context"
 	"fmt"
 	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 )
 
 //type Val interface {
@@ -47,6 +52,61 @@ type Val interface {
   String() string
 }
 
+type Callable interface {
+  Val
+  // caller is the context the call is made from, nil when called from Go.
+  Execute(args []Val, caller *Context) RTResult
+}
+
+type HasFields interface {
+  GetField(string) Val
+  SetField(string, Val) bool
+}
+
+func describe(value any) string {
+  switch v := value.(type) {
+    case nil:
+      return "null"
+    case *Instance:
+      return fmt.Sprintf("'%v' object", v.Class.Name)
+    case *GoObject:
+      return fmt.Sprintf("'%v' object", v.info.name)
+    case *Class:
+      return fmt.Sprintf("class '%v'", v.Name)
+    case *Module:
+      return fmt.Sprintf("module '%v'", v.Name)
+    case Val:
+      return v.String()
+  }
+  return fmt.Sprintf("%v", value)
+}
+
+// show is String for values inside lists, maps, instances and objects.
+// Lists, maps and objects already being shown further up are given as
+// [...], {...} and their description, since they may contain themselves.
+func show(value Val, seen map[any]bool) string {
+  switch v := value.(type) {
+    case *ListVal:
+      return v.show(seen)
+    case *MapVal:
+      return v.show(seen)
+    case *Instance:
+      return v.show(seen)
+    case *GoObject:
+      return v.show(seen)
+  }
+  return value.String()
+}
+
+// describeIn is describe for the fields of instances and objects, see show.
+func describeIn(value Val, seen map[any]bool) string {
+  switch value.(type) {
+    case *ListVal, *MapVal:
+      return show(value, seen)
+  }
+  return describe(value)
+}
+
 type Value struct {
   PosStart *Position
   PosEnd *Position
@@ -61,7 +121,6 @@ func (v *Value) SetPos(pos_start, pos_end *Position) Val {
 
 func (v *Value) Copy() Val {
   panic("No copy method defined")
-  return nil
 }
 
 func (v *Value) SetContext(context *Context) Val {
@@ -134,29 +193,31 @@ func (v *Value) IsTrue() bool {
   return false
 }
 
+func (v *Value) getPosEnd() *Position {
+  return v.PosEnd
+}
+
 func (v *Value) IllegalOperation(other Val) *Error {
-  if other == nil { other = v }
-  switch o := other.(type) {
-    case *Number:
-      return RTError(
-        *v.PosStart, *o.PosEnd,
-        "Illegal operation",
-        *v.Context,
-      )
-    case *StringVal:
-      return RTError(
-        *v.PosStart, *o.PosEnd,
-        "Illegal operation",
-        *v.Context,
-      )
-    case *Function:
-      return RTError(
-        *v.PosStart, *o.PosEnd,
-        "Illegal operation",
-        *v.Context,
-      )
+  posStart := v.PosStart
+  posEnd := v.PosEnd
+  if o, ok := other.(interface{ getPosEnd() *Position }); ok && o.getPosEnd() != nil {
+    posEnd = o.getPosEnd()
   }
-  return nil
+  if posStart == nil {
+    posStart = posEnd
+  }
+  if posStart == nil {
+    return &Error{ErrorName: "Runtime Error", Details: "Illegal operation", Type: "rterror"}
+  }
+  var context Context
+  if v.Context != nil {
+    context = *v.Context
+  }
+  err := RTError(*posStart, *posEnd, "Illegal operation", context)
+  if v.Context == nil {
+    err.Context = nil
+  }
+  return err
 }
 
 func (v *Value) String() string {
@@ -177,7 +238,6 @@ func NewString(value string) Val {
 type StringVal struct {
   Value
   value string
-  Context *Context
 }
 
 func (s *StringVal) SetPos(PosStart, PosEnd *Position) Val {
@@ -265,7 +325,6 @@ func NewNumber(value any) Val {
 type Number struct {
   Value
   value any
-  Context *Context
 }
 
 func (n *Number) SetPos(pos_start, pos_end *Position) Val {
@@ -620,6 +679,10 @@ type Function struct {
   Name string
   BodyNode Node
   ArgNames []string
+  Class *Class
+  Layout *FrameLayout
+  Code *Chunk
+  Generator bool
 }
 
 func (f *Function) SetPos(pos_start, pos_end *Position) Val {
@@ -633,41 +696,141 @@ func (f *Function) SetContext(context *Context) Val {
   return f
 }
 
-func (f *Function) Execute(args []Val) (RTResult){
+// Execute runs the function. Tail calls made by the body come back as a
+// TailCall and run in a loop here, so tail recursion does not grow the Go
+// stack. Their frames are counted in Context.Elided for tracebacks.
+func (f *Function) Execute(args []Val, caller *Context) (RTResult){
   res := RTResult{}
   interpreter := Interpreter{}
 
-  newCtx := Context{DisplayName: f.Name, Parent: f.Context, ParentEntryPos: f.PosStart}
-  newCtx.SymbolTable = NewSymbolTable(newCtx.Parent.SymbolTable)
-
-  if len(args) > len(f.ArgNames) {
-    return res.Failure(*RTError(
-      *f.PosStart, *f.PosEnd,
-      fmt.Sprintf("%v too few args passed into '%v'", len(f.ArgNames)-len(args), f.Name),
-      *f.Context,
-    ))
+  if caller == nil {
+    caller = f.Context
   }
-  if len(args) < len(f.ArgNames) {
-    return res.Failure(*RTError(
-      *f.PosStart, *f.PosEnd,
-      fmt.Sprintf("%v too many args passed into '%v'", len(f.ArgNames)-len(args), f.Name),
-      *f.Context,
-    ))
+  newCtx := &Context{
+    DisplayName: f.Name,
+    Parent: caller,
+    ParentEntryPos: f.PosStart,
+    Depth: caller.Depth + 1,
+    run: caller.run,
+  }
+  if newCtx.Depth > caller.maxDepth() {
+    return res.Failure(*RTError(*f.PosStart, *f.PosEnd, "maximum recursion depth exceeded", *caller))
   }
 
-  for i := range len(args) {
-    argName := f.ArgNames[i]
-    argVal := args[i]
-    argVal.SetContext(&newCtx)
-    newCtx.SymbolTable.Set(argName, argVal)
+  // The frame the current call is made from, the one it replaced after a
+  // tail call.
+  from := caller
+  for {
+    if err := from.run.step(*f.PosStart, *f.PosEnd, *from); err != nil {
+      return res.Failure(*err)
+    }
+    newCtx.SymbolTable = NewFrame(f.Context.SymbolTable, f.Layout)
+
+    if len(args) > len(f.ArgNames) {
+      return res.Failure(*RTError(
+        *f.PosStart, *f.PosEnd,
+        fmt.Sprintf("%v too few args passed into '%v'", len(f.ArgNames)-len(args), f.Name),
+        *from,
+      ))
+    }
+    if len(args) < len(f.ArgNames) {
+      return res.Failure(*RTError(
+        *f.PosStart, *f.PosEnd,
+        fmt.Sprintf("%v too many args passed into '%v'", len(f.ArgNames)-len(args), f.Name),
+        *from,
+      ))
+    }
+
+    for i := range len(args) {
+      argName := f.ArgNames[i]
+      // The caller may still hold the value, or another task may be passing
+      // it too, so the frame gets its own.
+      argVal := args[i].Copy().SetContext(newCtx)
+      if err := newCtx.run.retain(argVal, *f.PosStart, *f.PosEnd, *from); err != nil {
+        from.run.releaseFrame(newCtx.SymbolTable)
+        return res.Failure(*err)
+      }
+      newCtx.SymbolTable.Set(argName, argVal)
+    }
+    if f.Class != nil && len(args) > 0 {
+      if self, ok := args[0].(*Instance); ok {
+        super := NewSuper(self, f.Class)
+        if err := newCtx.run.retain(super, *f.PosStart, *f.PosEnd, *from); err != nil {
+          from.run.releaseFrame(newCtx.SymbolTable)
+          return res.Failure(*err)
+        }
+        newCtx.SymbolTable.Set("super", super)
+      }
+    }
+    if f.Generator {
+      return res.Success(NewGenerator(f, *newCtx).SetContext(from).SetPos(f.PosStart, f.PosEnd))
+    }
+    var Val any
+    if hooks := from.run.hooks(); hooks != nil {
+      Val = res.Register(callHooked(hooks, f.BodyNode, *from, f, args, func() RTResult {
+        return interpreter.Visit(f.BodyNode, *newCtx)
+      }))
+    } else if f.Code != nil {
+      Val = res.Register(f.Code.Run(*newCtx))
+    } else {
+      Val = res.Register(interpreter.Visit(f.BodyNode, *newCtx))
+    }
+    // The frame is done with, a tail call gets a new one.
+    newCtx.run.releaseFrame(newCtx.SymbolTable)
+    if res.error != nil { return res }
+    if call := res.tailCall; call != nil {
+      f, args = call.Function, call.Args
+      from = newCtx
+      newCtx = &Context{
+        DisplayName: f.Name,
+        Parent: newCtx.Parent,
+        ParentEntryPos: newCtx.ParentEntryPos,
+        Elided: newCtx.Elided + 1,
+        Depth: newCtx.Depth,
+        run: newCtx.run,
+      }
+      res = RTResult{}
+      if newCtx.Elided > from.maxTailCalls() {
+        return res.Failure(*RTError(*f.PosStart, *f.PosEnd, "maximum recursion depth exceeded", *from))
+      }
+      continue
+    }
+    if res.shouldReturn {
+      Val = res.funcReturnValue
+    }
+    // An empty body or one ending in a statement gives null.
+    if Val == nil {
+      Val = null(*from)
+    }
+    return RTResult{value: Val}
   }
-  Val := res.Register(interpreter.Visit(f.BodyNode, newCtx))
-  if res.error != nil { return res }
-  return res.Success(Val)
+}
+
+// Call calls f from Go like Engine.Call, with the budgets and the modules of
+// the run that defined it. Go code can keep a function it was handed and call it later.
+// The hooks and the stats of that run are left out, they belong to it.
+func (f *Function) Call(args ...any) (any, error) {
+  return f.CallContext(gocontext.Background(), args...)
+}
+
+func (f *Function) CallContext(ctx gocontext.Context, args ...any) (any, error) {
+  var options Options
+  if f.Context != nil && f.Context.run != nil {
+    options = f.Context.run.options
+    options.Modules = f.Context.run.modules
+    options.Hooks, options.Stats = nil, nil
+  }
+  return callFromGo(ctx, f, options, args)
+}
+
+// CallWithOptions calls f with options of its own, which are used as they
+// are, rather than with those of the run that defined it.
+func (f *Function) CallWithOptions(ctx gocontext.Context, options Options, args ...any) (any, error) {
+  return callFromGo(ctx, f, options, args)
 }
 
 func (f *Function) Copy() Val {
-  copy := Function{Name: f.Name, BodyNode: f.BodyNode, ArgNames: f.ArgNames}
+  copy := Function{Name: f.Name, BodyNode: f.BodyNode, ArgNames: f.ArgNames, Class: f.Class, Layout: f.Layout, Code: f.Code, Generator: f.Generator}
   copy.SetContext(f.Context)
   copy.SetPos(f.PosStart, f.PosEnd)
   return &copy
@@ -676,3 +839,1218 @@ func (f *Function) Copy() Val {
 func (f Function) String() string {
   return fmt.Sprintf("<function %v>", f.Name)
 }
+
+///////////////////////////////////////////////////////////////////////////
+
+func NewClass(name string, parent *Class, fieldNames []string, fieldNodes []Node) *Class {
+  c := &Class{
+    Name: name,
+    Parent: parent,
+    FieldNames: fieldNames,
+    FieldNodes: fieldNodes,
+    Methods: make(map[string]*Function),
+  }
+  c.SetPos(nil, nil)
+  c.SetContext(nil)
+  return c
+}
+
+type Class struct {
+  Value
+  Name string
+  Parent *Class
+  FieldNames []string
+  FieldNodes []Node
+  Methods map[string]*Function
+}
+
+func (c *Class) SetPos(pos_start, pos_end *Position) Val {
+  c.PosStart = pos_start
+  c.PosEnd = pos_end
+  return c
+}
+
+func (c *Class) SetContext(context *Context) Val {
+  c.Context = context
+  return c
+}
+
+func (c *Class) Copy() Val {
+  copy := *c
+  return &copy
+}
+
+func (c *Class) AllFieldNames() []string {
+  var names []string
+  if c.Parent != nil {
+    names = c.Parent.AllFieldNames()
+  }
+  for _, name := range c.FieldNames {
+    if !contains(names, name) {
+      names = append(names, name)
+    }
+  }
+  return names
+}
+
+func (c *Class) FindMethod(name string) *Function {
+  for class := c; class != nil; class = class.Parent {
+    if method, ok := class.Methods[name]; ok {
+      return method
+    }
+  }
+  return nil
+}
+
+func (c *Class) GetField(name string) Val {
+  if method := c.FindMethod(name); method != nil {
+    return method
+  }
+  return nil
+}
+
+func (c *Class) SetField(name string, value Val) bool {
+  return false
+}
+
+func (c *Class) initFields(instance *Instance) RTResult {
+  res := RTResult{}
+  if c.Parent != nil {
+    res.Register(c.Parent.initFields(instance))
+    if res.error != nil { return res }
+  }
+
+  interpreter := Interpreter{}
+  for idx, name := range c.FieldNames {
+    var value Val = NewNumber(0)
+    if c.FieldNodes[idx] != nil {
+      value = res.Register(interpreter.Visit(c.FieldNodes[idx], *c.Context)).(Val)
+      if res.error != nil { return res }
+    }
+    instance.Fields.Set(name, value)
+  }
+  return res.Success(nil)
+}
+
+func (c *Class) Execute(args []Val, caller *Context) RTResult {
+  res := RTResult{}
+  instance := NewInstance(c)
+  instance.SetContext(c.Context).SetPos(c.PosStart, c.PosEnd)
+
+  res.Register(c.initFields(instance))
+  if res.error != nil { return res }
+
+  if init := c.FindMethod("init"); init != nil {
+    method := NewBoundMethod(instance, init)
+    method.SetContext(c.Context).SetPos(c.PosStart, c.PosEnd)
+    res.Register(method.Execute(args, caller))
+    if res.error != nil { return res }
+    return res.Success(instance)
+  }
+
+  fieldNames := c.AllFieldNames()
+  if len(args) > len(fieldNames) {
+    return res.Failure(*RTError(
+      *c.PosStart, *c.PosEnd,
+      fmt.Sprintf("%v too many args passed into '%v'", len(args)-len(fieldNames), c.Name),
+      *c.Context,
+    ))
+  }
+  for idx, arg := range args {
+    instance.Fields.Set(fieldNames[idx], arg)
+  }
+  return res.Success(instance)
+}
+
+func (c *Class) IsTrue() bool {
+  return true
+}
+
+func (c Class) String() string {
+  return fmt.Sprintf("<class %v>", c.Name)
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+func NewInstance(class *Class) *Instance {
+  i := &Instance{
+    Class: class,
+    Fields: NewSymbolTable(nil),
+  }
+  i.SetPos(nil, nil)
+  i.SetContext(nil)
+  return i
+}
+
+type Instance struct {
+  Value
+  Class *Class
+  Fields *SymbolTable
+}
+
+func (i *Instance) SetPos(pos_start, pos_end *Position) Val {
+  i.PosStart = pos_start
+  i.PosEnd = pos_end
+  return i
+}
+
+func (i *Instance) SetContext(context *Context) Val {
+  i.Context = context
+  return i
+}
+
+func (i *Instance) Copy() Val {
+  copy := *i
+  return &copy
+}
+
+func (i *Instance) holds() *holds {
+  return &i.Fields.holds
+}
+
+func (i *Instance) contents() ([]Val, int) {
+  values := i.Fields.values()
+  return values, len(values)*slotSize
+}
+
+func (i *Instance) GetField(name string) Val {
+  if symbol := i.Fields.Lookup(name); symbol != nil {
+    return symbol.Value
+  }
+  if method := i.Class.FindMethod(name); method != nil {
+    return NewBoundMethod(i, method).SetContext(i.Context)
+  }
+  return nil
+}
+
+func (i *Instance) SetField(name string, value Val) bool {
+  if i.Fields.Lookup(name) == nil {
+    return false
+  }
+  i.Fields.Set(name, value)
+  return true
+}
+
+func (i *Instance) CompEQ(other Val) (Val, *Error) {
+  if o, ok := other.(*Instance); ok {
+    return NewNumber(BoolToInt(i.Fields == o.Fields)).SetContext(i.Context), nil
+  }
+  return NewNumber(0).SetContext(i.Context), nil
+}
+
+func (i *Instance) CompNE(other Val) (Val, *Error) {
+  if o, ok := other.(*Instance); ok {
+    return NewNumber(BoolToInt(i.Fields != o.Fields)).SetContext(i.Context), nil
+  }
+  return NewNumber(1).SetContext(i.Context), nil
+}
+
+func (i *Instance) IsTrue() bool {
+  return true
+}
+
+func (i Instance) String() string {
+  return i.show(map[any]bool{})
+}
+
+func (i Instance) show(seen map[any]bool) string {
+  result := i.Class.Name + "("
+  for idx, name := range i.Class.AllFieldNames() {
+    if idx > 0 {
+      result += ", "
+    }
+    result += fmt.Sprintf("%v=%v", name, describeIn(i.Fields.Get(name), seen))
+  }
+  return result + ")"
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+func NewBoundMethod(instance *Instance, method *Function) *BoundMethod {
+  b := &BoundMethod{
+    Instance: instance,
+    Method: method,
+  }
+  b.SetPos(nil, nil)
+  b.SetContext(nil)
+  return b
+}
+
+type BoundMethod struct {
+  Value
+  Instance *Instance
+  Method *Function
+}
+
+func (b *BoundMethod) SetPos(pos_start, pos_end *Position) Val {
+  b.PosStart = pos_start
+  b.PosEnd = pos_end
+  return b
+}
+
+func (b *BoundMethod) SetContext(context *Context) Val {
+  b.Context = context
+  return b
+}
+
+func (b *BoundMethod) Copy() Val {
+  copy := *b
+  return &copy
+}
+
+func (b *BoundMethod) Execute(args []Val, caller *Context) RTResult {
+  method := b.Method.Copy().SetPos(b.PosStart, b.PosEnd).(*Function)
+  return method.Execute(append([]Val{b.Instance}, args...), caller)
+}
+
+func (b *BoundMethod) IsTrue() bool {
+  return true
+}
+
+func (b BoundMethod) String() string {
+  return fmt.Sprintf("<method %v.%v>", b.Instance.Class.Name, b.Method.Name)
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+func NewSuper(instance *Instance, class *Class) *Super {
+  s := &Super{
+    Instance: instance,
+    Class: class,
+  }
+  s.SetPos(nil, nil)
+  s.SetContext(nil)
+  return s
+}
+
+type Super struct {
+  Value
+  Instance *Instance
+  Class *Class
+}
+
+func (s *Super) SetPos(pos_start, pos_end *Position) Val {
+  s.PosStart = pos_start
+  s.PosEnd = pos_end
+  return s
+}
+
+func (s *Super) SetContext(context *Context) Val {
+  s.Context = context
+  return s
+}
+
+func (s *Super) Copy() Val {
+  copy := *s
+  return &copy
+}
+
+func (s *Super) GetField(name string) Val {
+  if s.Class.Parent == nil {
+    return nil
+  }
+  if method := s.Class.Parent.FindMethod(name); method != nil {
+    return NewBoundMethod(s.Instance, method).SetContext(s.Context)
+  }
+  return nil
+}
+
+func (s *Super) SetField(name string, value Val) bool {
+  return false
+}
+
+func (s *Super) IsTrue() bool {
+  return true
+}
+
+func (s Super) String() string {
+  return fmt.Sprintf("<super of %v>", s.Class.Name)
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+func NewModule(name, path string, symbolTable *SymbolTable) *Module {
+  m := &Module{
+    Name: name,
+    Path: path,
+    SymbolTable: symbolTable,
+  }
+  m.SetPos(nil, nil)
+  m.SetContext(nil)
+  return m
+}
+
+type Module struct {
+  Value
+  Name string
+  Path string
+  SymbolTable *SymbolTable
+}
+
+func (m *Module) SetPos(pos_start, pos_end *Position) Val {
+  m.PosStart = pos_start
+  m.PosEnd = pos_end
+  return m
+}
+
+func (m *Module) SetContext(context *Context) Val {
+  m.Context = context
+  return m
+}
+
+func (m *Module) Copy() Val {
+  copy := *m
+  return &copy
+}
+
+func (m *Module) GetField(name string) Val {
+  if symbol := m.SymbolTable.Lookup(name); symbol != nil {
+    return symbol.Value
+  }
+  return nil
+}
+
+func (m *Module) SetField(name string, value Val) bool {
+  return false
+}
+
+func (m *Module) IsTrue() bool {
+  return true
+}
+
+func (m Module) String() string {
+  return fmt.Sprintf("<module %v>", m.Name)
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+// BuiltinFunction is a function implemented in Go. Fn reports errors with
+// b.Error, which points at the call.
+func NewBuiltinFunction(name string, argNames []string, fn func(b *BuiltinFunction, args []Val, context Context) RTResult) *BuiltinFunction {
+  b := &BuiltinFunction{Name: name, ArgNames: argNames, Fn: fn}
+  b.SetPos(nil, nil)
+  b.SetContext(nil)
+  return b
+}
+
+type BuiltinFunction struct {
+  Value
+  Name string
+  ArgNames []string
+  Fn func(b *BuiltinFunction, args []Val, context Context) RTResult
+}
+
+func (b *BuiltinFunction) SetPos(pos_start, pos_end *Position) Val {
+  b.PosStart = pos_start
+  b.PosEnd = pos_end
+  return b
+}
+
+func (b *BuiltinFunction) SetContext(context *Context) Val {
+  b.Context = context
+  return b
+}
+
+func (b *BuiltinFunction) Copy() Val {
+  copy := *b
+  return &copy
+}
+
+func (b *BuiltinFunction) Error(details string, context Context) *Error {
+  if b.PosStart == nil {
+    return &Error{ErrorName: "Runtime Error", Details: details, Type: "rterror"}
+  }
+  return RTError(*b.PosStart, *b.PosEnd, details, context)
+}
+
+func builtinResult(value Val, err *Error) RTResult {
+  res := RTResult{}
+  if err != nil {
+    return res.Failure(*err)
+  }
+  return res.Success(value)
+}
+
+func (b *BuiltinFunction) Execute(args []Val, caller *Context) RTResult {
+  res := RTResult{}
+  context := Context{}
+  if caller != nil {
+    context = *caller
+  }
+  if len(args) != len(b.ArgNames) {
+    return res.Failure(*b.Error(
+      fmt.Sprintf("'%v' takes %v argument(s), got %v", b.Name, len(b.ArgNames), len(args)),
+      context,
+    ))
+  }
+  if hooks := context.run.hooks(); hooks != nil {
+    hooked := context
+    return callHooked(hooks, nil, hooked, b, args, func() RTResult {
+      return b.Fn(b, args, hooked)
+    })
+  }
+  return b.Fn(b, args, context)
+}
+
+func (b *BuiltinFunction) IsTrue() bool {
+  return true
+}
+
+func (b BuiltinFunction) String() string {
+  return fmt.Sprintf("<built-in function %v>", b.Name)
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+// Task is the handle of a call started with spawn. Copies share the result.
+type Task struct {
+  Value
+  state *taskState
+}
+
+type taskState struct {
+  done chan struct{}
+  result RTResult
+}
+
+// Spawn runs callee in a new goroutine. The task's frames lead back to
+// caller in tracebacks.
+func Spawn(callee Callable, args []Val, caller Context) *Task {
+  t := &Task{state: &taskState{done: make(chan struct{})}}
+  t.SetPos(nil, nil)
+  t.SetContext(nil)
+  if caller.run != nil {
+    caller.run.spawned.Store(true)
+  }
+  go func() {
+    defer close(t.state.done)
+    t.state.result = callee.Execute(args, &caller)
+  }()
+  return t
+}
+
+// Await waits for the task and returns a copy of its value, or its error.
+func (t *Task) Await(posStart, posEnd Position, context Context) RTResult {
+  res := RTResult{}
+  select {
+    case <-t.state.done:
+    case <-context.run.done():
+      return res.Failure(*context.run.interrupted(posStart, posEnd, context))
+  }
+  if t.state.result.error != nil {
+    return res.Failure(*t.state.result.error)
+  }
+  // Every task awaiting the result gets a copy it may set the position of.
+  if value, ok := t.state.result.value.(Val); ok {
+    return res.Success(value.Copy())
+  }
+  return res.Success(t.state.result.value)
+}
+
+func (t *Task) SetPos(pos_start, pos_end *Position) Val {
+  t.PosStart = pos_start
+  t.PosEnd = pos_end
+  return t
+}
+
+func (t *Task) SetContext(context *Context) Val {
+  t.Context = context
+  return t
+}
+
+func (t *Task) Copy() Val {
+  copy := *t
+  return &copy
+}
+
+func (t *Task) IsTrue() bool {
+  return true
+}
+
+func (t Task) String() string {
+  select {
+    case <-t.state.done:
+      return "<task done>"
+    default:
+      return "<task running>"
+  }
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+// Channel passes values between tasks, with the methods send, receive and
+// close. Receiving from a closed and drained channel gives null.
+func NewChannel(size int) *Channel {
+  c := &Channel{ch: make(chan Val, size)}
+  c.SetPos(nil, nil)
+  c.SetContext(nil)
+  return c
+}
+
+type Channel struct {
+  Value
+  ch chan Val
+}
+
+func builtinChannel(b *BuiltinFunction, args []Val, context Context) RTResult {
+  res := RTResult{}
+  var size int
+  num, ok := args[0].(*Number)
+  if ok {
+    size, ok = num.value.(int)
+  }
+  if !ok || size < 0 {
+    return res.Failure(*b.Error(fmt.Sprintf("channel size must be a non-negative int, got %v", describe(args[0])), context))
+  }
+  return res.Success(NewChannel(size).SetContext(&context))
+}
+
+func (c *Channel) Send(value Val, posStart, posEnd Position, context Context) (err *Error) {
+  defer func() {
+    if recover() != nil {
+      context.run.release(value)
+      err = RTError(posStart, posEnd, "send on closed channel", context)
+    }
+  }()
+  // The value is kept by the channel until it is received.
+  if err := context.run.retain(value, posStart, posEnd, context); err != nil {
+    return err
+  }
+  select {
+    case c.ch <- value:
+      return nil
+    case <-context.run.done():
+      context.run.release(value)
+      return context.run.interrupted(posStart, posEnd, context)
+  }
+}
+
+func (c *Channel) Receive(posStart, posEnd Position, context Context) (Val, *Error) {
+  select {
+    case value, ok := <-c.ch:
+      if !ok {
+        return null(context), nil
+      }
+      context.run.release(value)
+      return value, nil
+    case <-context.run.done():
+      return nil, context.run.interrupted(posStart, posEnd, context)
+  }
+}
+
+func (c *Channel) Close(posStart, posEnd Position, context Context) (err *Error) {
+  defer func() {
+    if recover() != nil {
+      err = RTError(posStart, posEnd, "close of closed channel", context)
+    }
+  }()
+  close(c.ch)
+  return nil
+}
+
+func (c *Channel) GetField(name string) Val {
+  switch name {
+    case "send":
+      return NewBuiltinFunction(name, []string{"value"}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        return builtinResult(null(context), c.Send(args[0], *b.PosStart, *b.PosEnd, context))
+      })
+    case "receive":
+      return NewBuiltinFunction(name, []string{}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        return builtinResult(c.Receive(*b.PosStart, *b.PosEnd, context))
+      })
+    case "close":
+      return NewBuiltinFunction(name, []string{}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        return builtinResult(null(context), c.Close(*b.PosStart, *b.PosEnd, context))
+      })
+  }
+  return nil
+}
+
+func (c *Channel) SetField(name string, value Val) bool {
+  return false
+}
+
+func (c *Channel) SetPos(pos_start, pos_end *Position) Val {
+  c.PosStart = pos_start
+  c.PosEnd = pos_end
+  return c
+}
+
+func (c *Channel) SetContext(context *Context) Val {
+  c.Context = context
+  return c
+}
+
+func (c *Channel) Copy() Val {
+  copy := *c
+  return &copy
+}
+
+func (c *Channel) IsTrue() bool {
+  return true
+}
+
+func (c Channel) String() string {
+  return fmt.Sprintf("<channel %v/%v>", len(c.ch), cap(c.ch))
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+// GeneratorVal is what calling a function that yields returns. Its body runs
+// as a coroutine, up to the next yield each time a value is asked for, and a
+// return or the end of the body ends the sequence. Copies share the state.
+func NewGenerator(f *Function, frame Context) *GeneratorVal {
+  state := &generatorState{
+    function: f,
+    co: &coroutine{resume: make(chan struct{}), yields: make(chan RTResult), stop: make(chan struct{})},
+  }
+  frame.coroutine = state.co
+  state.frame = frame
+  // A generator that is dropped half way leaves its body waiting to be
+  // resumed, it is told to stop once nothing refers to the generator.
+  runtime.AddCleanup(state, func(co *coroutine) { close(co.stop) }, state.co)
+  g := &GeneratorVal{Name: f.Name, state: state}
+  g.SetPos(nil, nil)
+  g.SetContext(nil)
+  return g
+}
+
+type GeneratorVal struct {
+  Value
+  Name string
+  state *generatorState
+}
+
+type generatorState struct {
+  mu sync.Mutex
+  function *Function
+  // The frame of the call, with the arguments set.
+  frame Context
+  started bool
+  finished bool
+  // A value done ran the body for, which the next call to Next returns.
+  peeked Val
+  co *coroutine
+}
+
+// coroutine is the part of a generator its body sees, it must not refer back
+// to the generator so that dropped generators can be cleaned up.
+type coroutine struct {
+  resume chan struct{}
+  yields chan RTResult
+  stop chan struct{}
+}
+
+func (co *coroutine) run(f *Function, frame Context) {
+  defer close(co.yields)
+  var res RTResult
+  if f.Code != nil {
+    res = f.Code.Run(frame)
+  } else {
+    interpreter := Interpreter{}
+    res = interpreter.Visit(f.BodyNode, frame)
+  }
+  if res.error != nil {
+    select {
+      case co.yields <- RTResult{error: res.error}:
+      case <-co.stop:
+    }
+  }
+}
+
+// yield hands value to whoever asked for it and waits to be resumed.
+func (co *coroutine) yield(value Val, posStart, posEnd Position, context Context) *Error {
+  select {
+    case co.yields <- RTResult{value: value}:
+    case <-co.stop:
+      return InterruptError(posStart, posEnd, "generator was dropped", context)
+    case <-context.run.done():
+      return context.run.interrupted(posStart, posEnd, context)
+  }
+  select {
+    case <-co.resume:
+      return nil
+    case <-co.stop:
+      return InterruptError(posStart, posEnd, "generator was dropped", context)
+    case <-context.run.done():
+      return context.run.interrupted(posStart, posEnd, context)
+  }
+}
+
+// Next runs the generator to its next yield. It reports false once the
+// sequence has ended, and keeps doing so.
+func (g *GeneratorVal) Next(posStart, posEnd Position, context Context) (Val, bool, *Error) {
+  s := g.state
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if s.peeked != nil {
+    value := s.peeked
+    s.peeked = nil
+    return value, true, nil
+  }
+  return s.next(posStart, posEnd, context)
+}
+
+// Done reports whether the sequence has ended. To know, it runs the body to
+// its next yield and keeps the value for Next.
+func (g *GeneratorVal) Done(posStart, posEnd Position, context Context) (bool, *Error) {
+  s := g.state
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if s.peeked != nil {
+    return false, nil
+  }
+  value, ok, err := s.next(posStart, posEnd, context)
+  if ok {
+    s.peeked = value
+  }
+  return !ok, err
+}
+
+func (s *generatorState) next(posStart, posEnd Position, context Context) (Val, bool, *Error) {
+  if s.finished {
+    return nil, false, nil
+  }
+  if !s.started {
+    s.started = true
+    go s.co.run(s.function, s.frame)
+  } else {
+    select {
+      case s.co.resume <- struct{}{}:
+      case <-context.run.done():
+        return nil, false, context.run.interrupted(posStart, posEnd, context)
+    }
+  }
+  select {
+    case res, ok := <-s.co.yields:
+      if !ok {
+        s.finished = true
+        return nil, false, nil
+      }
+      if res.error != nil {
+        s.finished = true
+        return nil, false, res.error
+      }
+      value, _ := res.value.(Val)
+      return value, true, nil
+    case <-context.run.done():
+      return nil, false, context.run.interrupted(posStart, posEnd, context)
+  }
+}
+
+// GetField gives the methods next, which returns null once the sequence has
+// ended, and done, which tells that apart from a null that was yielded.
+func (g *GeneratorVal) GetField(name string) Val {
+  switch name {
+    case "next":
+      return NewBuiltinFunction(name, []string{}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        value, ok, err := g.Next(*b.PosStart, *b.PosEnd, context)
+        if !ok && err == nil {
+          value = null(context)
+        }
+        return builtinResult(value, err)
+      })
+    case "done":
+      return NewBuiltinFunction(name, []string{}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        done, err := g.Done(*b.PosStart, *b.PosEnd, context)
+        return builtinResult(boolean(done, context), err)
+      })
+  }
+  return nil
+}
+
+func (g *GeneratorVal) SetField(name string, value Val) bool {
+  return false
+}
+
+func (g *GeneratorVal) SetPos(pos_start, pos_end *Position) Val {
+  g.PosStart = pos_start
+  g.PosEnd = pos_end
+  return g
+}
+
+func (g *GeneratorVal) SetContext(context *Context) Val {
+  g.Context = context
+  return g
+}
+
+func (g *GeneratorVal) Copy() Val {
+  copy := *g
+  return &copy
+}
+
+func (g *GeneratorVal) IsTrue() bool {
+  return true
+}
+
+func (g GeneratorVal) String() string {
+  return fmt.Sprintf("<generator %v>", g.Name)
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+// Iterator is what a for-in loop runs over. Next reports false once there
+// are no more values.
+type Iterator interface {
+  Next(posStart, posEnd Position, context Context) (Val, bool, *Error)
+}
+
+// ListVal is a list of values, with the methods get, set and append. Copies
+// share the elements, which tasks may use at the same time.
+func NewList(elements []Val) *ListVal {
+  l := &ListVal{data: &listData{elements: elements}}
+  l.SetPos(nil, nil)
+  l.SetContext(nil)
+  return l
+}
+
+type ListVal struct {
+  Value
+  data *listData
+}
+
+type listData struct {
+  mu sync.RWMutex
+  elements []Val
+  holds holds
+}
+
+// Elements returns a copy of the elements.
+func (l *ListVal) Elements() []Val {
+  l.data.mu.RLock()
+  defer l.data.mu.RUnlock()
+  return append([]Val{}, l.data.elements...)
+}
+
+func (l *ListVal) Len() int {
+  l.data.mu.RLock()
+  defer l.data.mu.RUnlock()
+  return len(l.data.elements)
+}
+
+func (l *ListVal) holds() *holds {
+  return &l.data.holds
+}
+
+func (l *ListVal) contents() ([]Val, int) {
+  elements := l.Elements()
+  return elements, len(elements)*slotSize
+}
+
+func (l *ListVal) index(value Val, b *BuiltinFunction, context Context) (int, *Error) {
+  num, ok := value.(*Number)
+  var idx int
+  if ok {
+    idx, ok = num.value.(int)
+  }
+  if !ok {
+    return 0, b.Error(fmt.Sprintf("list index must be an int, got %v", describe(value)), context)
+  }
+  if length := len(l.data.elements); idx < 0 || idx >= length {
+    return 0, b.Error(fmt.Sprintf("list index %v out of range for length %v", idx, length), context)
+  }
+  return idx, nil
+}
+
+func (l *ListVal) GetField(name string) Val {
+  switch name {
+    case "get":
+      return NewBuiltinFunction(name, []string{"index"}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        l.data.mu.RLock()
+        defer l.data.mu.RUnlock()
+        idx, err := l.index(args[0], b, context)
+        if err != nil {
+          return builtinResult(nil, err)
+        }
+        // The element stays in the list, which other tasks may read too.
+        return builtinResult(l.data.elements[idx].Copy(), nil)
+      })
+    case "set":
+      return NewBuiltinFunction(name, []string{"index", "value"}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        l.data.mu.Lock()
+        defer l.data.mu.Unlock()
+        idx, err := l.index(args[0], b, context)
+        if err != nil {
+          return builtinResult(nil, err)
+        }
+        if err := context.run.store(l, l.data.elements[idx], args[1], *b.PosStart, *b.PosEnd, context); err != nil {
+          return builtinResult(nil, err)
+        }
+        l.data.elements[idx] = args[1]
+        return builtinResult(null(context), nil)
+      })
+    case "append":
+      return NewBuiltinFunction(name, []string{"value"}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        l.data.mu.Lock()
+        defer l.data.mu.Unlock()
+        if err := context.run.store(l, nil, args[0], *b.PosStart, *b.PosEnd, context); err != nil {
+          return builtinResult(nil, err)
+        }
+        if err := context.run.grow(l, slotSize, *b.PosStart, *b.PosEnd, context); err != nil {
+          context.run.release(args[0])
+          return builtinResult(nil, err)
+        }
+        l.data.elements = append(l.data.elements, args[0])
+        return builtinResult(null(context), nil)
+      })
+  }
+  return nil
+}
+
+func (l *ListVal) SetField(name string, value Val) bool {
+  return false
+}
+
+// The iterator of a list sees elements appended while the loop runs.
+func (l *ListVal) iterator() Iterator {
+  return &listIterator{list: l}
+}
+
+type listIterator struct {
+  list *ListVal
+  idx int
+}
+
+func (it *listIterator) Next(posStart, posEnd Position, context Context) (Val, bool, *Error) {
+  it.list.data.mu.RLock()
+  defer it.list.data.mu.RUnlock()
+  if it.idx >= len(it.list.data.elements) {
+    return nil, false, nil
+  }
+  it.idx += 1
+  return it.list.data.elements[it.idx-1], true, nil
+}
+
+func (l *ListVal) CompEQ(other Val) (Val, *Error) {
+  o, ok := other.(*ListVal)
+  return NewNumber(BoolToInt(ok && l.data == o.data)).SetContext(l.Context), nil
+}
+
+func (l *ListVal) CompNE(other Val) (Val, *Error) {
+  o, ok := other.(*ListVal)
+  return NewNumber(BoolToInt(!ok || l.data != o.data)).SetContext(l.Context), nil
+}
+
+func (l *ListVal) SetPos(pos_start, pos_end *Position) Val {
+  l.PosStart = pos_start
+  l.PosEnd = pos_end
+  return l
+}
+
+func (l *ListVal) SetContext(context *Context) Val {
+  l.Context = context
+  return l
+}
+
+func (l *ListVal) Copy() Val {
+  copy := *l
+  return &copy
+}
+
+func (l *ListVal) IsTrue() bool {
+  return l.Len() > 0
+}
+
+func (l ListVal) String() string {
+  return l.show(map[any]bool{})
+}
+
+func (l ListVal) show(seen map[any]bool) string {
+  if seen[l.data] {
+    return "[...]"
+  }
+  seen[l.data] = true
+  defer delete(seen, l.data)
+  parts := []string{}
+  for _, element := range l.Elements() {
+    parts = append(parts, show(element, seen))
+  }
+  return "[" + strings.Join(parts, ", ") + "]"
+}
+
+///////////////////////////////////////////////////////////////////////////
+
+// MapVal maps strings to values, with the methods get, set, has and keys.
+// get gives null for missing keys. Copies share the entries.
+func NewMap(entries map[string]Val) *MapVal {
+  m := &MapVal{data: &mapData{entries: entries}}
+  m.SetPos(nil, nil)
+  m.SetContext(nil)
+  return m
+}
+
+type MapVal struct {
+  Value
+  data *mapData
+}
+
+type mapData struct {
+  mu sync.RWMutex
+  entries map[string]Val
+  holds holds
+}
+
+// Keys returns the keys in sorted order.
+func (m *MapVal) Keys() []string {
+  m.data.mu.RLock()
+  defer m.data.mu.RUnlock()
+  keys := make([]string, 0, len(m.data.entries))
+  for key := range m.data.entries {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
+
+func (m *MapVal) Get(key string) (Val, bool) {
+  m.data.mu.RLock()
+  defer m.data.mu.RUnlock()
+  value, ok := m.data.entries[key]
+  return value, ok
+}
+
+func (m *MapVal) Len() int {
+  m.data.mu.RLock()
+  defer m.data.mu.RUnlock()
+  return len(m.data.entries)
+}
+
+func (m *MapVal) holds() *holds {
+  return &m.data.holds
+}
+
+func (m *MapVal) contents() ([]Val, int) {
+  m.data.mu.RLock()
+  defer m.data.mu.RUnlock()
+  values := make([]Val, 0, len(m.data.entries))
+  size := 0
+  for key, value := range m.data.entries {
+    values = append(values, value)
+    size += entrySize(key)
+  }
+  return values, size
+}
+
+func mapKey(value Val, b *BuiltinFunction, context Context) (string, *Error) {
+  key, ok := value.(*StringVal)
+  if !ok {
+    return "", b.Error(fmt.Sprintf("map keys must be strings, got %v", describe(value)), context)
+  }
+  return key.value, nil
+}
+
+func (m *MapVal) GetField(name string) Val {
+  switch name {
+    case "get":
+      return NewBuiltinFunction(name, []string{"key"}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        key, err := mapKey(args[0], b, context)
+        if err != nil {
+          return builtinResult(nil, err)
+        }
+        if value, ok := m.Get(key); ok {
+          return builtinResult(value.Copy(), nil)
+        }
+        return builtinResult(null(context), nil)
+      })
+    case "set":
+      return NewBuiltinFunction(name, []string{"key", "value"}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        key, err := mapKey(args[0], b, context)
+        if err != nil {
+          return builtinResult(nil, err)
+        }
+        m.data.mu.Lock()
+        defer m.data.mu.Unlock()
+        old, ok := m.data.entries[key]
+        if err := context.run.store(m, old, args[1], *b.PosStart, *b.PosEnd, context); err != nil {
+          return builtinResult(nil, err)
+        }
+        if !ok {
+          if err := context.run.grow(m, entrySize(key), *b.PosStart, *b.PosEnd, context); err != nil {
+            context.run.release(args[1])
+            return builtinResult(nil, err)
+          }
+        }
+        m.data.entries[key] = args[1]
+        return builtinResult(null(context), nil)
+      })
+    case "has":
+      return NewBuiltinFunction(name, []string{"key"}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        key, err := mapKey(args[0], b, context)
+        if err != nil {
+          return builtinResult(nil, err)
+        }
+        _, ok := m.Get(key)
+        return builtinResult(boolean(ok, context), nil)
+      })
+    case "keys":
+      return NewBuiltinFunction(name, []string{}, func(b *BuiltinFunction, args []Val, context Context) RTResult {
+        return builtinResult(m.keyList(context), nil)
+      })
+  }
+  return nil
+}
+
+func (m *MapVal) keyList(context Context) *ListVal {
+  keys := []Val{}
+  for _, key := range m.Keys() {
+    keys = append(keys, NewString(key).SetContext(&context))
+  }
+  return NewList(keys)
+}
+
+func (m *MapVal) SetField(name string, value Val) bool {
+  return false
+}
+
+// Maps iterate over their keys as they were when the loop started.
+func (m *MapVal) iterator(context Context) Iterator {
+  return m.keyList(context).iterator()
+}
+
+func (m *MapVal) CompEQ(other Val) (Val, *Error) {
+  o, ok := other.(*MapVal)
+  return NewNumber(BoolToInt(ok && m.data == o.data)).SetContext(m.Context), nil
+}
+
+func (m *MapVal) CompNE(other Val) (Val, *Error) {
+  o, ok := other.(*MapVal)
+  return NewNumber(BoolToInt(!ok || m.data != o.data)).SetContext(m.Context), nil
+}
+
+func (m *MapVal) SetPos(pos_start, pos_end *Position) Val {
+  m.PosStart = pos_start
+  m.PosEnd = pos_end
+  return m
+}
+
+func (m *MapVal) SetContext(context *Context) Val {
+  m.Context = context
+  return m
+}
+
+func (m *MapVal) Copy() Val {
+  copy := *m
+  return &copy
+}
+
+func (m *MapVal) IsTrue() bool {
+  return m.Len() > 0
+}
+
+func (m MapVal) String() string {
+  return m.show(map[any]bool{})
+}
+
+func (m MapVal) show(seen map[any]bool) string {
+  if seen[m.data] {
+    return "{...}"
+  }
+  seen[m.data] = true
+  defer delete(seen, m.data)
+  parts := []string{}
+  for _, key := range m.Keys() {
+    value, _ := m.Get(key)
+    parts = append(parts, fmt.Sprintf("%v: %v", quoteString(key), show(value, seen)))
+  }
+  return "{" + strings.Join(parts, ", ") + "}"
+}
@@ -0,0 +1,102 @@
+package lang
+
+import (
+	"testing"
+)
+
+// Run with -race, tasks reading the same elements must not share them.
+func TestCollectionsGiveCopies(t *testing.T) {
+  text := "fn id(x) { x }\nfn read() { var i = 0; while i < 50 { id(items.get(0)); id(names.get(\"a\")); native(items.get(1)); +counts.get(0); var i = i + 1 } }\n" +
+    "var a = spawn read()\nvar b = spawn read()\nawait a; await b\nitems.get(0) + names.get(\"a\")"
+  for _, vm := range []bool{false, true} {
+    engine := NewEngine()
+    engine.Options.VM = vm
+    if err := engine.Set("items", []any{"x", "y"}); err != nil {
+      t.Fatal(err)
+    }
+    if err := engine.Set("counts", []any{1}); err != nil {
+      t.Fatal(err)
+    }
+    if err := engine.Set("names", map[string]any{"a": "z"}); err != nil {
+      t.Fatal(err)
+    }
+    if err := engine.Register("native", func(s string) string { return s }); err != nil {
+      t.Fatal(err)
+    }
+    result, err := engine.Run("<test>", text)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if result != "xz" {
+      t.Errorf("vm %v: got %v", vm, result)
+    }
+  }
+}
+
+func TestCollectionsChargeMemory(t *testing.T) {
+  tests := []string{
+    "while 1 { items.append(\"abcdefgh\") }",
+    "var i = 0\nwhile 1 { names.set(str(i), i); var i = i + 1 }",
+  }
+  for _, text := range tests {
+    for _, vm := range []bool{false, true} {
+      engine := NewEngine()
+      engine.Options = Options{VM: vm, MaxMemory: 1 << 16}
+      engine.Set("items", []any{})
+      engine.Set("names", map[string]any{})
+      _, err := engine.Run("<test>", text)
+      if rtErr, ok := err.(*Error); !ok || !rtErr.Interrupted() {
+        t.Errorf("%q (vm %v): got %v, want the memory limit", text, vm, err)
+      }
+    }
+  }
+
+  // Replacing elements gives back what they held.
+  text := "var i = 0\nwhile i < 10000 { items.set(0, \"abcdefgh\" + str(i)); names.set(\"a\", str(i)); var i = i + 1 }"
+  engine := NewEngine()
+  engine.Options.MaxMemory = 1 << 16
+  engine.Set("items", []any{"x"})
+  engine.Set("names", map[string]any{})
+  if _, err := engine.Run("<test>", text); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestCollectionsContainingThemselves(t *testing.T) {
+  engine := NewEngine()
+  if err := engine.Set("l", []any{1}); err != nil {
+    t.Fatal(err)
+  }
+  if err := engine.Set("m", map[string]any{}); err != nil {
+    t.Fatal(err)
+  }
+  result, err := engine.Run("<test>", "l.append(l)\nm.set(\"l\", l)\nm.set(\"m\", m)\nl.append(m)\nstr(l) + \" \" + str(m)")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := "[1, [...], {\"l\": [...], \"m\": {...}}] {\"l\": [1, [...], {...}], \"m\": {...}}"; result != want {
+    t.Errorf("got %v, want %v", result, want)
+  }
+
+  value, _ := engine.Get("l")
+  list := value.([]any)
+  if inner := list[1].([]any); &inner[0] != &list[0] {
+    t.Error("the list in the list is not the list")
+  }
+  m := list[2].(map[string]any)
+  if m["m"].(map[string]any)["l"] == nil {
+    t.Errorf("got %v", m)
+  }
+
+  // Instances are shown with their fields, which may hold the list they are in.
+  if err := engine.Set("items", []any{}); err != nil {
+    t.Fatal(err)
+  }
+  result, err = engine.Run("<test>", "class P { items }\nvar p = P(items)\nitems.append(p)\nstr(p)")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if want := "P(items=[P(items=[...])])"; result != want {
+    t.Errorf("got %v, want %v", result, want)
+  }
+}
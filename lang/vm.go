@@ -0,0 +1,248 @@
+package lang
+
+type forState struct {
+  value int
+  end int
+  step int
+  // Set instead of the bounds for a for-in loop.
+  values Iterator
+  // The table the loop runs in, the body may run in iteration frames.
+  table *SymbolTable
+}
+
+// Frame is one activation of a chunk: the program being run, the position in
+// it and the context that variables and errors refer to.
+type Frame struct {
+  Chunk *Chunk
+  IP int
+  Context Context
+  stack []any
+}
+
+func (f *Frame) push(value any) {
+  f.stack = append(f.stack, value)
+}
+
+func (f *Frame) pop() any {
+  value := f.stack[len(f.stack)-1]
+  f.stack = f.stack[:len(f.stack)-1]
+  return value
+}
+
+func (f *Frame) peek() any {
+  return f.stack[len(f.stack)-1]
+}
+
+// Run executes the chunk in context. The result has the same shape as the
+// interpreter's: a return sets shouldReturn, otherwise the value of the last
+// statement is the result.
+func (c *Chunk) Run(context Context) RTResult {
+  frame := &Frame{Chunk: c, Context: context, stack: make([]any, 0, 16)}
+  return frame.run()
+}
+
+func (f *Frame) run() RTResult {
+  res := RTResult{}
+  interpreter := &Interpreter{program: f.Chunk.Program}
+  code := f.Chunk.Code
+
+  for f.IP < len(code) {
+    ins := code[f.IP]
+    f.IP += 1
+
+    switch ins.Op {
+      case OpConst:
+        var value Val
+        var posStart, posEnd *Position
+        switch node := ins.Node.(type) {
+          case *StringNode:
+            value, posStart, posEnd = NewString(f.Chunk.Constants[ins.Arg].(string)), &node.PosStart, &node.PosEnd
+          case *NumberNode:
+            value, posStart, posEnd = NewNumber(f.Chunk.Constants[ins.Arg]), &node.PosStart, &node.PosEnd
+        }
+        if err := f.Context.run.charge(value, *posStart, *posEnd, f.Context); err != nil {
+          return res.Failure(*err)
+        }
+        f.push(value.SetContext(&f.Context).SetPos(posStart, posEnd))
+      case OpNil:
+        f.push(nil)
+      case OpNull:
+        f.push(null(f.Context))
+      case OpPop:
+        f.pop()
+      case OpGetVar:
+        value := res.Register(interpreter.VisitVarAccessNode(ins.Node.(*VarAccessNode), f.Context))
+        if res.error != nil { return res }
+        f.push(value)
+      case OpSetVar:
+        node := ins.Node.(*VarAssignNode)
+        value := f.pop()
+        var err *Error
+        if node.IsUpdate {
+          err = interpreter.assign(node.VarName, node.Binding, value.(Val), f.Context)
+        } else {
+          err = interpreter.declareAt(node.VarName, node.Binding, value.(Val), node.IsConst, f.Context)
+        }
+        if err != nil {
+          return res.Failure(*err)
+        }
+        f.push(nil)
+      case OpBinary:
+        node := ins.Node.(*BinOpNode)
+        right, left := f.pop(), f.pop()
+        leftNum, ok1 := left.(Val)
+        rightNum, ok2 := right.(Val)
+        if !ok1 || !ok2 {
+          panic("Operands must be values")
+        }
+        result, err := binaryOp(leftNum, node.OpTok, rightNum)
+        if err != nil { return res.Failure(*err) }
+        if err := f.Context.run.charge(result, node.PosStart, node.PosEnd, f.Context); err != nil {
+          return res.Failure(*err)
+        }
+        f.push(result.SetPos(&node.PosStart, &node.PosEnd))
+      case OpUnary:
+        node := ins.Node.(*UnaryOpNode)
+        num, ok := f.pop().(Val)
+        if !ok {
+          panic("Operand must be a number")
+        }
+        result, err := unaryOp(node.OpTok, num)
+        if err != nil { return res.Failure(*err) }
+        if err := f.Context.run.charge(result, node.PosStart, node.PosEnd, f.Context); err != nil {
+          return res.Failure(*err)
+        }
+        f.push(result.SetPos(&node.PosStart, &node.PosEnd))
+      case OpJump:
+        f.IP = ins.Arg
+      case OpJumpIfFalse:
+        if cond, ok := f.pop().(Val); !ok || !cond.IsTrue() {
+          f.IP = ins.Arg
+        }
+      case OpForPrep:
+        if ins.Arg == 2 {
+          values, err := iterator(ins.Node.(*ForNode), f.pop(), f.Context)
+          if err != nil { return res.Failure(*err) }
+          f.push(&forState{values: values, table: f.Context.SymbolTable})
+          continue
+        }
+        stepNum := NewNumber(1).(*Number)
+        if ins.Arg == 1 {
+          stepNum = f.pop().(*Number)
+        }
+        endNum := f.pop().(*Number)
+        startNum := f.pop().(*Number)
+        f.push(&forState{
+          value: startNum.value.(int),
+          end: endNum.value.(int),
+          step: stepNum.value.(int),
+          table: f.Context.SymbolTable,
+        })
+      case OpForIter:
+        node := ins.Node.(*ForNode)
+        state := f.peek().(*forState)
+        f.Context.SymbolTable = state.table
+        var value Val
+        if state.values != nil {
+          next, ok, err := state.values.Next(node.PosStart, node.PosEnd, f.Context)
+          if err != nil { return res.Failure(*err) }
+          if !ok {
+            f.pop()
+            f.push(nil)
+            f.IP = ins.Arg
+            continue
+          }
+          value = next
+        } else {
+          if state.step >= 0 && state.value > state.end || state.step < 0 && state.value < state.end {
+            f.pop()
+            f.push(nil)
+            f.IP = ins.Arg
+            continue
+          }
+          value = NewNumber(state.value)
+          state.value += state.step
+        }
+        if err := interpreter.declareAt(node.VarNameTok, node.Binding, value, false, f.Context); err != nil {
+          return res.Failure(*err)
+        }
+        if err := f.Context.run.step(node.PosStart, node.PosEnd, f.Context); err != nil {
+          return res.Failure(*err)
+        }
+        if node.Layout != nil {
+          f.Context.SymbolTable = NewIterationFrame(state.table, node.Layout)
+          f.Context.SymbolTable.SetSlot(0, node.VarNameTok.value.(string), value)
+        }
+      case OpFunction:
+        value := res.Register(interpreter.VisitFuncDefNode(ins.Node.(*FuncDefNode), f.Context))
+        if res.error != nil { return res }
+        f.push(value)
+      case OpCallable:
+        value, err := callable(ins.Node.(*CallNode), f.pop(), f.Context)
+        if err != nil { return res.Failure(*err) }
+        f.push(value)
+      case OpCall:
+        args := make([]Val, ins.Arg)
+        for idx := ins.Arg - 1; idx >= 0; idx-- {
+          args[idx] = f.pop().(Val)
+        }
+        callee := f.pop().(Callable)
+        if ins.Node.(*CallNode).Tail {
+          if call := tailCall(callee, args); call != nil {
+            return res.SuccessTailCall(call)
+          }
+        }
+        value := res.Register(callee.Execute(args, &f.Context))
+        if res.ShouldReturn() { return res }
+        if result, ok := value.(Val); ok {
+          node := ins.Node.(*CallNode)
+          if err := f.Context.run.charge(result, node.PosStart, node.PosEnd, f.Context); err != nil {
+            return res.Failure(*err)
+          }
+        }
+        f.push(value)
+      case OpSpawn:
+        node := ins.Node.(*SpawnNode)
+        args := make([]Val, ins.Arg)
+        for idx := ins.Arg - 1; idx >= 0; idx-- {
+          args[idx] = f.pop().(Val)
+        }
+        callee := f.pop().(Callable)
+        f.push(Spawn(callee, args, f.Context).SetContext(&f.Context).SetPos(&node.PosStart, &node.PosEnd))
+      case OpYield:
+        res.Register(yield(ins.Node.(*YieldNode), f.pop(), f.Context))
+        if res.error != nil { return res }
+        f.push(nil)
+      case OpAwait:
+        value := res.Register(await(ins.Node.(*AwaitNode), f.pop(), f.Context))
+        if res.error != nil { return res }
+        f.push(value)
+      case OpGetField:
+        value := res.Register(getField(ins.Node.(*FieldAccessNode), f.pop(), f.Context))
+        if res.error != nil { return res }
+        f.push(value)
+      case OpSetField:
+        value, object := f.pop(), f.pop()
+        res.Register(setField(ins.Node.(*FieldAssignNode), object, value, f.Context))
+        if res.error != nil { return res }
+        f.push(nil)
+      case OpReturn:
+        return res.SuccessReturn(f.pop())
+      case OpLoop:
+        node := ins.Node.(*WhileNode)
+        if err := f.Context.run.step(node.PosStart, node.PosEnd, f.Context); err != nil {
+          return res.Failure(*err)
+        }
+      case OpEval:
+        value := res.Register(interpreter.Visit(ins.Node, f.Context))
+        if res.ShouldReturn() { return res }
+        f.push(value)
+    }
+  }
+
+  var value any
+  if len(f.stack) > 0 {
+    value = f.pop()
+  }
+  return res.Success(value)
+}
@@ -0,0 +1,181 @@
+package lang
+
+import "fmt"
+
+type Visitor interface {
+  Visit(node Node) Visitor
+}
+
+func walkList(v Visitor, nodes []Node) {
+  for _, node := range nodes {
+    if node != nil {
+      Walk(v, node)
+    }
+  }
+}
+
+func walkOptional(v Visitor, node Node) {
+  if node != nil {
+    Walk(v, node)
+  }
+}
+
+// Walk visits node in depth-first order, like go/ast.Walk: children are only
+// visited when v.Visit(node) returns a non-nil visitor, which is then called
+// with nil once all children are done.
+func Walk(v Visitor, node Node) {
+  if v = v.Visit(node); v == nil {
+    return
+  }
+
+  switch n := node.(type) {
+    case *NumberNode, *StringNode, *VarAccessNode, *SuperNode, *ImportNode, *FromImportNode:
+    case *IfNode:
+      for _, Case := range n.Cases {
+        walkList(v, Case)
+      }
+      walkOptional(v, n.ElseCase)
+    case *ForNode:
+      walkOptional(v, n.Iterable)
+      walkOptional(v, n.StartVal)
+      walkOptional(v, n.EndVal)
+      walkOptional(v, n.StepVal)
+      Walk(v, n.BodyNode)
+    case *WhileNode:
+      Walk(v, n.Cond)
+      Walk(v, n.BodyNode)
+    case *VarAssignNode:
+      Walk(v, n.ValueNode)
+    case *BinOpNode:
+      Walk(v, n.LeftNode)
+      Walk(v, n.RightNode)
+    case *UnaryOpNode:
+      Walk(v, n.Node)
+    case *FuncDefNode:
+      Walk(v, n.BodyNode)
+    case *CallNode:
+      Walk(v, n.NodeToCall)
+      walkList(v, n.ArgNodes)
+    case *StatementsNode:
+      walkList(v, n.Statements)
+    case *ReturnNode:
+      walkOptional(v, n.NodeToReturn)
+    case *YieldNode:
+      Walk(v, n.Node)
+    case *SpawnNode:
+      Walk(v, n.Call)
+    case *AwaitNode:
+      Walk(v, n.Node)
+    case *FieldAccessNode:
+      Walk(v, n.NodeToAccess)
+    case *FieldAssignNode:
+      Walk(v, n.NodeToAccess)
+      Walk(v, n.ValueNode)
+    case *ClassDefNode:
+      walkOptional(v, n.ParentNode)
+      walkList(v, n.FieldValueNodes)
+      for _, method := range n.MethodNodes {
+        Walk(v, method)
+      }
+    default:
+      panic(fmt.Sprintf("Walk: unexpected node type %T", node))
+  }
+
+  v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+  if f(node) {
+    return f
+  }
+  return nil
+}
+
+func Inspect(node Node, f func(Node) bool) {
+  Walk(inspector(f), node)
+}
+
+func transformList(nodes []Node, f func(Node) Node) {
+  for idx, node := range nodes {
+    if node != nil {
+      nodes[idx] = Transform(node, f)
+    }
+  }
+}
+
+func transformOptional(node Node, f func(Node) Node) Node {
+  if node == nil {
+    return nil
+  }
+  return Transform(node, f)
+}
+
+// Transform rewrites the tree bottom-up: the children of node are replaced
+// in place by their transformed versions before f is applied to node itself,
+// and whatever f returns takes the place of node in its parent.
+func Transform(node Node, f func(Node) Node) Node {
+  switch n := node.(type) {
+    case *NumberNode, *StringNode, *VarAccessNode, *SuperNode, *ImportNode, *FromImportNode:
+    case *IfNode:
+      for _, Case := range n.Cases {
+        transformList(Case, f)
+      }
+      n.ElseCase = transformOptional(n.ElseCase, f)
+    case *ForNode:
+      n.Iterable = transformOptional(n.Iterable, f)
+      n.StartVal = transformOptional(n.StartVal, f)
+      n.EndVal = transformOptional(n.EndVal, f)
+      n.StepVal = transformOptional(n.StepVal, f)
+      n.BodyNode = Transform(n.BodyNode, f)
+    case *WhileNode:
+      n.Cond = Transform(n.Cond, f)
+      n.BodyNode = Transform(n.BodyNode, f)
+    case *VarAssignNode:
+      n.ValueNode = Transform(n.ValueNode, f)
+    case *BinOpNode:
+      n.LeftNode = Transform(n.LeftNode, f)
+      n.RightNode = Transform(n.RightNode, f)
+    case *UnaryOpNode:
+      n.Node = Transform(n.Node, f)
+    case *FuncDefNode:
+      n.BodyNode = Transform(n.BodyNode, f)
+    case *CallNode:
+      n.NodeToCall = Transform(n.NodeToCall, f)
+      transformList(n.ArgNodes, f)
+    case *StatementsNode:
+      transformList(n.Statements, f)
+    case *ReturnNode:
+      n.NodeToReturn = transformOptional(n.NodeToReturn, f)
+    case *YieldNode:
+      n.Node = Transform(n.Node, f)
+    case *SpawnNode:
+      call, ok := Transform(n.Call, f).(*CallNode)
+      if !ok {
+        panic("Transform: spawned calls must stay *CallNode")
+      }
+      n.Call = call
+    case *AwaitNode:
+      n.Node = Transform(n.Node, f)
+    case *FieldAccessNode:
+      n.NodeToAccess = Transform(n.NodeToAccess, f)
+    case *FieldAssignNode:
+      n.NodeToAccess = Transform(n.NodeToAccess, f)
+      n.ValueNode = Transform(n.ValueNode, f)
+    case *ClassDefNode:
+      n.ParentNode = transformOptional(n.ParentNode, f)
+      transformList(n.FieldValueNodes, f)
+      for idx, method := range n.MethodNodes {
+        fdn, ok := Transform(method, f).(*FuncDefNode)
+        if !ok {
+          panic("Transform: class methods must stay *FuncDefNode")
+        }
+        n.MethodNodes[idx] = fdn
+      }
+    default:
+      panic(fmt.Sprintf("Transform: unexpected node type %T", node))
+  }
+
+  return f(node)
+}
@@ -0,0 +1,159 @@
+package lang
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func nodeName(node Node) string {
+  return strings.TrimPrefix(fmt.Sprintf("%T", node), "*lang.")
+}
+
+// walkTests cover every kind of node, the nodes are in the order Walk
+// visits them.
+var walkTests = []struct {
+  text  string
+  nodes string
+}{
+  {"1", "StatementsNode NumberNode"},
+  {`"s"`, "StatementsNode StringNode"},
+  {"x", "StatementsNode VarAccessNode"},
+  {"var x = 1", "StatementsNode VarAssignNode NumberNode"},
+  {"const x = 1", "StatementsNode VarAssignNode NumberNode"},
+  {"1 + 2", "StatementsNode BinOpNode NumberNode NumberNode"},
+  {"-x", "StatementsNode UnaryOpNode VarAccessNode"},
+  {"if a { 1 } elif b { 2 } else { 3 }", "StatementsNode IfNode VarAccessNode StatementsNode NumberNode VarAccessNode StatementsNode NumberNode StatementsNode NumberNode"},
+  {"for i = 1 in 10 -> 2 { i }", "StatementsNode ForNode NumberNode NumberNode NumberNode StatementsNode VarAccessNode"},
+  {"for x in xs { x }", "StatementsNode ForNode VarAccessNode StatementsNode VarAccessNode"},
+  {"while a { b }", "StatementsNode WhileNode VarAccessNode StatementsNode VarAccessNode"},
+  {"fn f(a) { return a }", "StatementsNode FuncDefNode StatementsNode ReturnNode VarAccessNode"},
+  {"fn g() { return }", "StatementsNode FuncDefNode StatementsNode ReturnNode"},
+  {"fn h() { yield 1 }", "StatementsNode FuncDefNode StatementsNode YieldNode NumberNode"},
+  {"f(1, 2)", "StatementsNode CallNode VarAccessNode NumberNode NumberNode"},
+  {"spawn f(1)", "StatementsNode SpawnNode CallNode VarAccessNode NumberNode"},
+  {"await t", "StatementsNode AwaitNode VarAccessNode"},
+  {"o.x", "StatementsNode FieldAccessNode VarAccessNode"},
+  {"o.x = 1", "StatementsNode FieldAssignNode VarAccessNode NumberNode"},
+  {"class A(B) { x = 1\n fn m(self) { super.m(self) } }", "StatementsNode ClassDefNode VarAccessNode NumberNode FuncDefNode StatementsNode CallNode FieldAccessNode SuperNode VarAccessNode"},
+  {`import "m.scv" as m`, "StatementsNode ImportNode"},
+  {`from "m.scv" import a, b`, "StatementsNode FromImportNode"},
+}
+
+func parseTest(t *testing.T, text string) Node {
+  t.Helper()
+  node, err := Parse("<test>", text)
+  if err != nil {
+    t.Fatalf("%q: %v", text, err.AsString())
+  }
+  return node
+}
+
+// orderVisitor records the nodes in the order they are entered and left.
+type orderVisitor struct {
+  pre, post []string
+  stack []Node
+}
+
+func (v *orderVisitor) Visit(node Node) Visitor {
+  if node == nil {
+    v.post = append(v.post, nodeName(v.stack[len(v.stack)-1]))
+    v.stack = v.stack[:len(v.stack)-1]
+    return nil
+  }
+  v.pre = append(v.pre, nodeName(node))
+  v.stack = append(v.stack, node)
+  return v
+}
+
+func TestWalk(t *testing.T) {
+  seen := map[string]bool{}
+  for _, test := range walkTests {
+    v := &orderVisitor{}
+    Walk(v, parseTest(t, test.text))
+    if got := strings.Join(v.pre, " "); got != test.nodes {
+      t.Errorf("%q: visited %v, want %v", test.text, got, test.nodes)
+    }
+    if len(v.stack) != 0 || len(v.post) != len(v.pre) {
+      t.Errorf("%q: %v nodes entered but %v left", test.text, len(v.pre), len(v.post))
+    }
+    for _, name := range v.pre {
+      seen[name] = true
+    }
+  }
+  // One of each type in nodes.go.
+  if len(seen) != 22 {
+    t.Errorf("the tests visit %v kinds of node, want all 22", len(seen))
+  }
+}
+
+func TestInspect(t *testing.T) {
+  for _, test := range walkTests {
+    names := []string{}
+    Inspect(parseTest(t, test.text), func(node Node) bool {
+      if node != nil {
+        names = append(names, nodeName(node))
+      }
+      return true
+    })
+    if got := strings.Join(names, " "); got != test.nodes {
+      t.Errorf("%q: inspected %v, want %v", test.text, got, test.nodes)
+    }
+  }
+
+  // Returning false skips the children.
+  names := []string{}
+  Inspect(parseTest(t, "fn f(a) { return a }\nf(1)"), func(node Node) bool {
+    if node != nil {
+      names = append(names, nodeName(node))
+    }
+    _, isFunc := node.(*FuncDefNode)
+    return !isFunc
+  })
+  want := "StatementsNode FuncDefNode CallNode VarAccessNode NumberNode"
+  if got := strings.Join(names, " "); got != want {
+    t.Errorf("pruned inspect visited %v, want %v", got, want)
+  }
+}
+
+func TestTransform(t *testing.T) {
+  for _, test := range walkTests {
+    v := &orderVisitor{}
+    Walk(v, parseTest(t, test.text))
+
+    node := parseTest(t, test.text)
+    before := node.(*StatementsNode).String()
+    names := []string{}
+    result := Transform(node, func(node Node) Node {
+      names = append(names, nodeName(node))
+      return node
+    })
+    if result != node || result.(*StatementsNode).String() != before {
+      t.Errorf("%q: identity transform changed the tree", test.text)
+    }
+    // Children are transformed before their parents.
+    if got, want := strings.Join(names, " "), strings.Join(v.post, " "); got != want {
+      t.Errorf("%q: transformed %v, want %v", test.text, got, want)
+    }
+  }
+
+  replacement := parseTest(t, "2").(*StatementsNode).Statements[0]
+  node := Transform(parseTest(t, "f(1, g(1))"), func(node Node) Node {
+    if _, ok := node.(*NumberNode); ok {
+      return replacement
+    }
+    return node
+  })
+  count := 0
+  Inspect(node, func(node Node) bool {
+    if node == replacement {
+      count++
+    } else if _, ok := node.(*NumberNode); ok {
+      t.Errorf("%v was not replaced", node)
+    }
+    return true
+  })
+  if count != 2 {
+    t.Errorf("replaced %v numbers, want 2", count)
+  }
+}
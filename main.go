@@ -2,6 +2,7 @@ package main
 
 import (
 	"SceneV/lang"
+	"io"
 	"os"
 	"fmt"
 
@@ -9,30 +10,242 @@ import (
 )
 
 func input(prompt string) string {
+	line, ok := readLine(prompt)
+	if !ok {
+		os.Exit(0)
+	}
+  return line
+}
+
+func readLine(prompt string) (string, bool) {
 	rl, err := readline.New(prompt)
 	if err != nil {
-		os.Exit(0)
+		return "", false
 	}
 	defer rl.Close()
 	line, err := rl.Readline()
+	return line, err == nil
+}
+
+
+func runFile(path string, options lang.Options) {
+	text, err := os.ReadFile(path)
 	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	_, rtErr := lang.RunWithOptions(path, string(text), lang.NewGlobals(), options)
+	if rtErr != nil {
+		exit(rtErr)
+	}
+}
+
+// exit ends the process for a run that failed, or that called exit.
+func exit(err *lang.Error) {
+	if err.Exited() {
 		os.Exit(0)
 	}
-  return line
+	fmt.Println(err.AsString())
+	os.Exit(1)
 }
 
+func debugFile(args []string) {
+	if len(args) != 1 {
+		fmt.Println("usage: scenev debug file")
+		os.Exit(2)
+	}
+	text, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	debugger := lang.NewDebugger(readLine, os.Stdout)
+	_, rtErr := debugger.Run(args[0], string(text), lang.NewGlobals(), lang.Options{})
+	if rtErr != nil {
+		exit(rtErr)
+	}
+}
+
+func dumpAST(args []string) {
+	asJSON := len(args) > 0 && args[0] == "-json"
+	asBytecode := len(args) > 0 && args[0] == "-bytecode"
+	if asJSON || asBytecode {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		fmt.Println("usage: scenev ast [-json | -bytecode] file")
+		os.Exit(2)
+	}
+	text, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	ast, parseErr := lang.Parse(args[0], string(text))
+	if parseErr != nil {
+		fmt.Println(parseErr.AsString())
+		os.Exit(1)
+	}
+	if asBytecode {
+		lang.Resolve(ast)
+		fmt.Print(lang.Compile(ast).Disassemble())
+		return
+	}
+	if !asJSON {
+		fmt.Println(ast.String())
+		return
+	}
+	data, err := lang.MarshalAST(ast)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+// formatFiles runs the fmt command, writing to out, and gives the status to
+// exit with.
+func formatFiles(args []string, out io.Writer) int {
+	write, check := false, false
+	for len(args) > 0 && (args[0] == "-w" || args[0] == "-check") {
+		if args[0] == "-w" {
+			write = true
+		} else {
+			check = true
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(out, "usage: scenev fmt [-w] [-check] files...")
+		return 2
+	}
+
+	failed := false
+	for _, path := range args {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			failed = true
+			continue
+		}
+		formatted, fmtErr := lang.Format(path, string(text))
+		if fmtErr != nil {
+			fmt.Fprintln(out, fmtErr.AsString())
+			failed = true
+			continue
+		}
+		changed := formatted != string(text)
+		switch {
+		case check:
+			if changed {
+				fmt.Fprintln(out, path)
+				failed = true
+			}
+		case write:
+			if changed {
+				if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+					fmt.Fprintln(out, err)
+					failed = true
+				}
+			}
+		default:
+			fmt.Fprint(out, formatted)
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func analyzeFiles(command string, args []string, analyze func(lang.Node, *lang.SymbolTable) []lang.Diagnostic) {
+	if len(args) == 0 {
+		fmt.Printf("usage: scenev %v files...\n", command)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range args {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Println(err)
+			failed = true
+			continue
+		}
+		ast, parseErr := lang.Parse(path, string(text))
+		if parseErr != nil {
+			fmt.Println(parseErr.AsString())
+			failed = true
+			continue
+		}
+		for _, diagnostic := range analyze(ast, lang.NewGlobals()) {
+			fmt.Println(diagnostic)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
 
 func main() {
-	globalSymbolTable := lang.NewSymbolTable(nil)
-  globalSymbolTable.Set("null", lang.NewNumber(0))
-  globalSymbolTable.Set("true", lang.NewNumber(1))
-  globalSymbolTable.Set("false", lang.NewNumber(0))
+	if len(os.Args) > 1 && os.Args[1] == "ast" {
+		dumpAST(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(formatFiles(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		debugFile(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		analyzeFiles("lint", os.Args[2:], lang.Lint)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		analyzeFiles("check", os.Args[2:], lang.Check)
+		return
+	}
+
+	args := os.Args[1:]
+	options := lang.Options{}
+	if len(args) > 0 && args[0] == "-vm" {
+		options.VM = true
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		runFile(args[0], options)
+		return
+	}
+
+	globalSymbolTable := lang.NewGlobals()
+	options.Modules = lang.NewModuleCache()
+	// Set by :debug, lines then run paused before their first statement.
+	var debugger *lang.Debugger
 
 	for {
 		text := input("SceneV> ")
+		if text == ":debug" {
+			if debugger == nil {
+				debugger = lang.NewDebugger(readLine, os.Stdout)
+				fmt.Println("Debugging on, type help when paused")
+			} else {
+				debugger = nil
+				fmt.Println("Debugging off")
+			}
+			continue
+		}
     if text != "" {
-		  result, err := lang.Run("<stdin>", text, globalSymbolTable)
-		  if err != nil {
+		  run := lang.RunWithOptions
+		  if debugger != nil {
+		  	run = debugger.Run
+		  }
+		  result, err := run("<stdin>", text, globalSymbolTable, options)
+		  if err != nil && err.Exited() {
+		  	os.Exit(0)
+		  } else if err != nil {
 		  	fmt.Println(err.AsString())
 		  } else if result != nil {
 		  	fmt.Println(result.(lang.Val).String())
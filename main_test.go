@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatCheck(t *testing.T) {
+  dir := t.TempDir()
+  formatted := filepath.Join(dir, "formatted.scv")
+  messy := filepath.Join(dir, "messy.scv")
+  broken := filepath.Join(dir, "broken.scv")
+  files := map[string]string{formatted: "var x = 1\n", messy: "var  x=1\n", broken: "var x =\n"}
+  for path, text := range files {
+    if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  tests := []struct {
+    args []string
+    status int
+    out string
+  }{
+    {[]string{"-check", formatted}, 0, ""},
+    {[]string{"-check", formatted, messy}, 1, messy + "\n"},
+    {[]string{"-check", broken}, 1, "Invalid Syntax"},
+    {[]string{"-check"}, 2, "usage"},
+    {[]string{messy}, 0, "var x = 1\n"},
+  }
+  for _, test := range tests {
+    var out strings.Builder
+    if status := formatFiles(test.args, &out); status != test.status {
+      t.Errorf("%v: exit status %v, want %v", test.args, status, test.status)
+    }
+    if !strings.Contains(out.String(), test.out) || test.out == "" && out.Len() > 0 {
+      t.Errorf("%v: printed %q, want %q", test.args, out.String(), test.out)
+    }
+  }
+
+  // -check leaves files alone, -w formats them.
+  if text, _ := os.ReadFile(messy); string(text) != files[messy] {
+    t.Errorf("-check changed %v", messy)
+  }
+  if status := formatFiles([]string{"-w", messy}, &strings.Builder{}); status != 0 {
+    t.Errorf("-w: exit status %v", status)
+  }
+  if status := formatFiles([]string{"-check", messy}, &strings.Builder{}); status != 0 {
+    t.Errorf("-check after -w: exit status %v", status)
+  }
+}